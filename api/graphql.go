@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/graphql-go/graphql"
+	"github.com/naman1402/geth-indexer/subsrciber"
+)
+
+var orderDirection = graphql.NewEnum(graphql.EnumConfig{
+	Name: "OrderDirection",
+	Values: graphql.EnumValueConfigMap{
+		"asc":  &graphql.EnumValueConfig{Value: "asc"},
+		"desc": &graphql.EnumValueConfig{Value: "desc"},
+	},
+})
+
+// buildSchema generates a GraphQL schema from the contract ABI. Every event gets an
+// object type, a <Event>Where input with one filter per indexed parameter and a
+// paginated list field on Query, e.g. transfers(where: {from: "0x..."}, first: 10).
+func buildSchema(store *Store, contractABI abi.ABI) (graphql.Schema, error) {
+	names := make([]string, 0, len(contractABI.Events))
+	for name := range contractABI.Events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := graphql.Fields{}
+	for _, name := range names {
+		ev := contractABI.Events[name]
+		fields[queryFieldName(ev.Name)] = eventField(store, ev)
+	}
+	if len(fields) == 0 {
+		return graphql.Schema{}, fmt.Errorf("contract ABI has no events")
+	}
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: fields}),
+	})
+}
+
+// eventField builds the object type, filter input and list field for one ABI event.
+func eventField(store *Store, ev abi.Event) *graphql.Field {
+	objectFields := graphql.Fields{
+		"id":          {Type: graphql.NewNonNull(graphql.ID), Resolve: resolveColumn("id")},
+		"cursor":      {Type: graphql.NewNonNull(graphql.String), Resolve: rowCursor},
+		"name":        {Type: graphql.String, Resolve: resolveColumn("name")},
+		"blockNumber": {Type: graphql.Int, Resolve: resolveColumn("blockNumber")},
+		"txnHash":     {Type: graphql.String, Resolve: resolveColumn("txnHash")},
+		"contract":    {Type: graphql.String, Resolve: resolveColumn("contract")},
+		"logIndex":    {Type: graphql.Int, Resolve: resolveColumn("logIndex")},
+		"decodedBy":   {Type: graphql.String, Resolve: resolveColumn("decodedBy")},
+	}
+	whereFields := graphql.InputObjectConfigFieldMap{
+		"contract":        {Type: graphql.String},
+		"txnHash":         {Type: graphql.String},
+		"blockNumber_gte": {Type: graphql.Int},
+		"blockNumber_lte": {Type: graphql.Int},
+	}
+
+	var indexed []string
+	for i, input := range ev.Inputs {
+		// unnamed arguments are stored as arg<i>
+		name := subsrciber.ArgumentName(input, i)
+		if _, exists := objectFields[name]; exists {
+			continue
+		}
+		objectFields[name] = &graphql.Field{Type: graphqlType(input.Type), Resolve: resolveColumn(name)}
+		if input.Indexed {
+			indexed = append(indexed, name)
+			whereFields[name] = &graphql.InputObjectFieldConfig{Type: graphql.String}
+			whereFields[name+"_in"] = &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))}
+		}
+	}
+
+	object := graphql.NewObject(graphql.ObjectConfig{Name: ev.Name, Fields: objectFields})
+	where := graphql.NewInputObject(graphql.InputObjectConfig{Name: ev.Name + "Where", Fields: whereFields})
+
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(object))),
+		Args: graphql.FieldConfigArgument{
+			"where":          {Type: where},
+			"first":          {Type: graphql.Int, DefaultValue: defaultLimit},
+			"after":          {Type: graphql.String},
+			"orderDirection": {Type: orderDirection, DefaultValue: "asc"},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			q := Query{
+				Event:     ev.Name,
+				Signature: ev.Sig,
+				Fields:    make(map[string][]string),
+			}
+			q.Limit, _ = p.Args["first"].(int)
+			q.Cursor, _ = p.Args["after"].(string)
+			q.Desc = p.Args["orderDirection"] == "desc"
+
+			w, _ := p.Args["where"].(map[string]interface{})
+			q.Contract, _ = w["contract"].(string)
+			q.TxHash, _ = w["txnHash"].(string)
+			if n, ok := w["blockNumber_gte"].(int); ok {
+				from := uint64(n)
+				q.FromBlock = &from
+			}
+			if n, ok := w["blockNumber_lte"].(int); ok {
+				to := uint64(n)
+				q.ToBlock = &to
+			}
+			for _, name := range indexed {
+				if v, ok := w[name].(string); ok {
+					q.Fields[name] = append(q.Fields[name], v)
+				}
+				if list, ok := w[name+"_in"].([]interface{}); ok {
+					for _, v := range list {
+						if s, ok := v.(string); ok {
+							q.Fields[name] = append(q.Fields[name], s)
+						}
+					}
+				}
+			}
+
+			page, err := store.Events(p.Context, q)
+			if err != nil {
+				return nil, err
+			}
+			return page.Events, nil
+		},
+	}
+}
+
+// graphqlType maps an ABI type to a GraphQL scalar. Integers are exposed as decimal
+// strings since uint256 does not fit GraphQL's 32-bit Int.
+func graphqlType(t abi.Type) graphql.Output {
+	if t.T == abi.BoolTy {
+		return graphql.Boolean
+	}
+	return graphql.String
+}
+
+// queryFieldName returns the list field name for an event, e.g. Transfer -> transfers.
+func queryFieldName(event string) string {
+	return strings.ToLower(event[:1]) + event[1:] + "s"
+}
+
+func resolveColumn(name string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		row, _ := p.Source.(Row)
+		if raw, ok := row[name].(json.RawMessage); ok {
+			// arrays and tuples are exposed as JSON strings
+			return string(raw), nil
+		}
+		return row[name], nil
+	}
+}
+
+func rowCursor(p graphql.ResolveParams) (interface{}, error) {
+	row, _ := p.Source.(Row)
+	block, _ := row["blockNumber"].(int64)
+	id, _ := row["id"].(int64)
+	return encodeCursor(block, id), nil
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// handleGraphQL serves GraphQL queries sent as a JSON POST body or a GET ?query= parameter.
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid GraphQL request body")
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         s.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/naman1402/geth-indexer/proto/indexerpb"
+	"github.com/naman1402/geth-indexer/subsrciber"
+)
+
+// grpcService implements indexerpb.IndexerServer on top of the Server's store, stream hub
+// and subscriber controller.
+type grpcService struct {
+	indexerpb.UnimplementedIndexerServer
+	s *Server
+}
+
+// ListenAndServeGRPC starts the gRPC server on addr and blocks until it fails.
+func (s *Server) ListenAndServeGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer()
+	indexerpb.RegisterIndexerServer(srv, &grpcService{s: s})
+	logger.Info("gRPC server listening", "addr", addr)
+	return srv.Serve(lis)
+}
+
+func (g *grpcService) ListEvents(ctx context.Context, req *indexerpb.ListEventsRequest) (*indexerpb.ListEventsResponse, error) {
+	q := Query{
+		Event:     req.Event,
+		Contract:  req.Contract,
+		Address:   req.Address,
+		Fields:    fieldFilters(req.Filters),
+		FromBlock: req.FromBlock,
+		ToBlock:   req.ToBlock,
+		TxHash:    req.TxnHash,
+		Cursor:    req.Cursor,
+		Limit:     int(req.Limit),
+		Desc:      req.Desc,
+	}
+	page, err := g.s.store.Events(ctx, q)
+	switch {
+	case errors.Is(err, ErrUnknownEvent):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidQuery):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		logger.Error("failed to query events", "event", req.Event, "err", err)
+		return nil, status.Error(codes.Internal, "failed to query events")
+	}
+
+	resp := &indexerpb.ListEventsResponse{
+		Events:     make([]*indexerpb.Event, 0, len(page.Events)),
+		NextCursor: page.NextCursor,
+	}
+	for _, row := range page.Events {
+		resp.Events = append(resp.Events, rowToProto(row))
+	}
+	return resp, nil
+}
+
+func (g *grpcService) GetCheckpoint(ctx context.Context, _ *indexerpb.GetCheckpointRequest) (*indexerpb.Checkpoint, error) {
+	return &indexerpb.Checkpoint{
+		LastBlock:        g.s.lastBlock.Load(),
+		LastId:           g.s.lastID.Load(),
+		Paused:           g.s.ctl.Paused(),
+		RunningBackfills: int32(g.s.ctl.RunningBackfills()),
+	}, nil
+}
+
+func (g *grpcService) SubscribeEvents(req *indexerpb.SubscribeEventsRequest, stream indexerpb.Indexer_SubscribeEventsServer) error {
+	client := g.s.hub.subscribe(streamFilter{
+		contract: req.Contract,
+		event:    req.Event,
+		fields:   fieldFilters(req.Filters),
+	})
+	defer g.s.hub.unsubscribe(client)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-client.overflow:
+			return status.Error(codes.ResourceExhausted, "client too slow, resubscribe and list events from the last cursor")
+		case row := <-client.events:
+			if err := stream.Send(rowToProto(row)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (g *grpcService) StartBackfill(ctx context.Context, req *indexerpb.StartBackfillRequest) (*indexerpb.StartBackfillResponse, error) {
+	if err := g.s.ctl.Backfill(req.FromBlock, req.ToBlock); err != nil {
+		return nil, controlError(err)
+	}
+	return &indexerpb.StartBackfillResponse{}, nil
+}
+
+func (g *grpcService) PauseIngestion(ctx context.Context, _ *indexerpb.PauseIngestionRequest) (*indexerpb.IngestionStatus, error) {
+	g.s.ctl.Pause()
+	return &indexerpb.IngestionStatus{Paused: true}, nil
+}
+
+func (g *grpcService) ResumeIngestion(ctx context.Context, _ *indexerpb.ResumeIngestionRequest) (*indexerpb.IngestionStatus, error) {
+	if err := g.s.ctl.Resume(); err != nil {
+		return nil, controlError(err)
+	}
+	return &indexerpb.IngestionStatus{Paused: false}, nil
+}
+
+func (g *grpcService) ReloadABI(ctx context.Context, req *indexerpb.ReloadABIRequest) (*indexerpb.ReloadABIResponse, error) {
+	if req.Contract != "" && common.HexToAddress(req.Contract) != g.s.contract {
+		return nil, status.Errorf(codes.NotFound, "contract %s is not indexed", req.Contract)
+	}
+	n, err := g.s.ctl.ReloadABI(ctx)
+	if err != nil {
+		return nil, controlError(err)
+	}
+	return &indexerpb.ReloadABIResponse{Events: int32(n)}, nil
+}
+
+func controlError(err error) error {
+	switch {
+	case errors.Is(err, subsrciber.ErrNotRunning):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, subsrciber.ErrRateLimited):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, subsrciber.ErrABINotFound):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+func fieldFilters(filters []*indexerpb.FieldFilter) map[string][]string {
+	fields := make(map[string][]string, len(filters))
+	for _, f := range filters {
+		fields[f.Field] = append(fields[f.Field], f.Values...)
+	}
+	return fields
+}
+
+// rowToProto converts a Row to an indexerpb.Event, encoding event fields as strings.
+func rowToProto(row Row) *indexerpb.Event {
+	ev := &indexerpb.Event{
+		Cursor: rowCursorString(row),
+		Fields: make(map[string]string),
+	}
+	ev.Id, _ = row["id"].(int64)
+	if block, ok := row["blockNumber"].(int64); ok {
+		ev.BlockNumber = uint64(block)
+	}
+	ev.Name = fmt.Sprint(row["name"])
+	ev.TxnHash = fmt.Sprint(row["txnHash"])
+	ev.Contract = fmt.Sprint(row["contract"])
+	ev.DecodedBy, _ = row["decodedBy"].(string)
+	if logIndex, ok := row["logIndex"].(int64); ok {
+		ev.LogIndex = uint32(logIndex)
+	}
+	for k, v := range row {
+		if baseColumns[k] || v == nil {
+			continue
+		}
+		switch val := v.(type) {
+		case json.RawMessage:
+			ev.Fields[k] = string(val)
+		case []interface{}, map[string]interface{}:
+			// arrays and tuples are sent as JSON
+			data, _ := json.Marshal(v)
+			ev.Fields[k] = string(data)
+		default:
+			ev.Fields[k] = fmt.Sprint(v)
+		}
+	}
+	return ev
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/naman1402/geth-indexer/metrics"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// check is the result of a single readiness check.
+type check struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type lagCheck struct {
+	OK     bool    `json:"ok"`
+	Blocks float64 `json:"blocks"`
+	Max    int     `json:"max"`
+}
+
+type readiness struct {
+	Status       string   `json:"status"`
+	Database     check    `json:"database"`
+	RPC          check    `json:"rpc"`
+	Subscription check    `json:"subscription"`
+	Lag          lagCheck `json:"lag"`
+}
+
+// handleHealthz is the liveness probe: the process is up and serving HTTP.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz is the readiness probe. It reports database and RPC connectivity, the
+// live subscription and whether the indexing lag is within MAX_LAG_BLOCKS, and answers
+// 503 if any check fails.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	res := readiness{
+		Database:     check{OK: true},
+		RPC:          check{OK: true},
+		Subscription: check{OK: true},
+		Lag:          lagCheck{OK: true, Blocks: metrics.Lag(), Max: s.maxLag},
+	}
+	if err := s.store.db.PingContext(ctx); err != nil {
+		res.Database = check{Detail: err.Error()}
+	}
+	status := s.ctl.Status()
+	if !status.RPCConnected {
+		res.RPC = check{Detail: "ethereum node unreachable"}
+	}
+	if !status.Subscribed {
+		res.Subscription = check{Detail: "live log subscription is down"}
+	}
+	if s.maxLag > 0 && res.Lag.Blocks > float64(s.maxLag) {
+		res.Lag.OK = false
+	}
+
+	code := http.StatusOK
+	res.Status = "ok"
+	if !res.Database.OK || !res.RPC.OK || !res.Subscription.OK || !res.Lag.OK {
+		code = http.StatusServiceUnavailable
+		res.Status = "unavailable"
+	}
+	writeJSON(w, code, res)
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/graphql-go/graphql"
+	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/logging"
+	"github.com/naman1402/geth-indexer/subsrciber"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var logger = logging.For("api")
+
+// Server exposes the indexed events over HTTP.
+type Server struct {
+	store    *Store
+	hub      *Hub
+	schema   graphql.Schema
+	mux      *http.ServeMux
+	contract common.Address
+	ctl      *subsrciber.Controller
+	maxLag   int
+
+	// lastBlock and lastID track the most recently committed event
+	lastBlock atomic.Uint64
+	lastID    atomic.Int64
+}
+
+// NewServer creates a Server reading from db and registers its routes. The GraphQL
+// endpoint is generated from the contract ABI and is skipped if the ABI has no events.
+// ctl is used by the admin RPCs of the gRPC service and by the readiness probe.
+func NewServer(opts cli.ServerConfig, db *sql.DB, contract *subsrciber.Contract, ctl *subsrciber.Controller) *Server {
+	s := &Server{
+		store:    NewStore(db),
+		hub:      NewHub(),
+		mux:      http.NewServeMux(),
+		contract: contract.Address,
+		ctl:      ctl,
+		maxLag:   opts.MaxLagBlocks,
+	}
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.mux.HandleFunc("GET /events/{event}", s.handleEvents)
+	s.mux.HandleFunc("GET /stream", s.handleStream)
+	s.mux.Handle("GET /metrics", promhttp.Handler())
+
+	schema, err := buildSchema(s.store, contract.ABI)
+	if err != nil {
+		logger.Warn("GraphQL disabled", "err", err)
+	} else {
+		s.schema = schema
+		s.mux.HandleFunc("GET /graphql", s.handleGraphQL)
+		s.mux.HandleFunc("POST /graphql", s.handleGraphQL)
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Publish streams a committed event to the connected /stream clients.
+// It is meant to be registered as an indexer.CommitHook.
+func (s *Server) Publish(id int64, e *subsrciber.Event) {
+	s.lastID.Store(id)
+	for {
+		last := s.lastBlock.Load()
+		if e.BlockNumber <= last || s.lastBlock.CompareAndSwap(last, e.BlockNumber) {
+			break
+		}
+	}
+	s.hub.Publish(id, e)
+}
+
+// ListenAndServe starts the HTTP server on addr and blocks until it fails.
+func (s *Server) ListenAndServe(addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	logger.Info("HTTP server listening", "addr", addr)
+	return srv.ListenAndServe()
+}
+
+// handleEvents serves GET /events/{event}. Supported query parameters:
+//
+//	contract, address, tx, from_block, to_block, order (asc|desc), cursor, limit
+//
+// Any other parameter is treated as a filter on an event field, e.g. ?from=0x...;
+// repeating it matches any of the values.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := Query{
+		Event:  r.PathValue("event"),
+		Fields: make(map[string][]string),
+	}
+	for key, values := range r.URL.Query() {
+		v := values[0]
+		switch key {
+		case "contract":
+			q.Contract = v
+		case "address":
+			q.Address = v
+		case "tx":
+			q.TxHash = v
+		case "cursor":
+			q.Cursor = v
+		case "limit":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "limit must be an integer")
+				return
+			}
+			q.Limit = n
+		case "order":
+			q.Desc = v == "desc"
+		case "from_block", "to_block":
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, key+" must be a block number")
+				return
+			}
+			if key == "from_block" {
+				q.FromBlock = &n
+			} else {
+				q.ToBlock = &n
+			}
+		default:
+			q.Fields[key] = values
+		}
+	}
+
+	page, err := s.store.Events(r.Context(), q)
+	switch {
+	case errors.Is(err, ErrUnknownEvent):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalidQuery):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		logger.Error("failed to query events", "event", q.Event, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to query events")
+	default:
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("failed to write response", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
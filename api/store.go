@@ -0,0 +1,409 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// baseColumns are written by the indexer for every event, independent of the ABI.
+var baseColumns = map[string]bool{
+	"id":          true,
+	"name":        true,
+	"blockNumber": true,
+	"txnHash":     true,
+	"contract":    true,
+	"logIndex":    true,
+	"decodedBy":   true,
+	"created_at":  true,
+}
+
+var (
+	// ErrUnknownEvent is returned when no table exists for the requested event.
+	ErrUnknownEvent = errors.New("unknown event")
+	// ErrInvalidQuery is returned when a filter or cursor cannot be applied.
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// Query describes a filtered, paginated read of one event table.
+type Query struct {
+	// Event is the ABI name ("Transfer"), signature ("Transfer(address,address,uint256)") or
+	// table ("transfer_1f2e3d4c") of the event, see Store.eventTable.
+	Event string
+	// Signature selects the table of one signature when Event names an event stored in
+	// several tables.
+	Signature string
+	// Contract restricts results to logs emitted by this contract address.
+	Contract string
+	// Address matches rows where any event field column equals the address.
+	Address string
+	// Fields holds filters on event field columns (e.g. "from", "to"). A row matches
+	// a field when the column equals any of the listed values.
+	Fields map[string][]string
+	// FromBlock and ToBlock bound the block range (inclusive) when non-nil.
+	FromBlock *uint64
+	ToBlock   *uint64
+	// TxHash restricts results to a single transaction.
+	TxHash string
+	// Cursor is the opaque cursor returned by a previous page.
+	Cursor string
+	// Desc orders results from the newest block to the oldest.
+	Desc bool
+	// Limit is the page size, defaults to defaultLimit and is capped at maxLimit.
+	Limit int
+}
+
+// Row is a single indexed event. uint256 (NUMERIC) values are encoded as decimal strings.
+type Row map[string]interface{}
+
+// Page is one page of query results.
+type Page struct {
+	Events     []Row  `json:"events"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type column struct {
+	name     string
+	dataType string
+}
+
+// Store reads the event tables written by the indexer package.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore returns a Store backed by db.
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// columns returns the columns of the event table, or ErrUnknownEvent if it does not exist.
+func (s *Store) columns(ctx context.Context, table string) ([]column, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT column_name, data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []column
+	for rows.Next() {
+		var c column
+		if err := rows.Scan(&c.name, &c.dataType); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, ErrUnknownEvent
+	}
+	return cols, nil
+}
+
+// Events runs q against the event table and returns one page of rows ordered by block number.
+func (s *Store) Events(ctx context.Context, q Query) (*Page, error) {
+	table, err := s.eventTable(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := s.columns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]string, len(cols))
+	for _, c := range cols {
+		known[c.name] = c.dataType
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.Contract != "" {
+		where = append(where, `"contract" = `+arg(normalizeAddress(q.Contract)))
+	}
+	if q.TxHash != "" {
+		where = append(where, `"txnHash" = `+arg(common.HexToHash(q.TxHash).Hex()))
+	}
+	if q.FromBlock != nil {
+		where = append(where, `"blockNumber" >= `+arg(*q.FromBlock))
+	}
+	if q.ToBlock != nil {
+		where = append(where, `"blockNumber" <= `+arg(*q.ToBlock))
+	}
+	for field, values := range q.Fields {
+		dataType, ok := known[field]
+		if !ok || baseColumns[field] {
+			return nil, fmt.Errorf("%w: unknown field %q for event %s", ErrInvalidQuery, field, q.Event)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		col := quoteIdent(field)
+		if !isTextType(dataType) {
+			col += "::text"
+		}
+		placeholders := make([]string, 0, len(values))
+		for _, v := range values {
+			placeholders = append(placeholders, arg(normalizeAddress(v)))
+		}
+		where = append(where, fmt.Sprintf("%s IN (%s)", col, strings.Join(placeholders, ", ")))
+	}
+	if q.Address != "" {
+		// match the address against every event-specific column
+		p := arg(normalizeAddress(q.Address))
+		var matches []string
+		for _, c := range cols {
+			if !baseColumns[c.name] && isTextType(c.dataType) {
+				matches = append(matches, fmt.Sprintf("%s = %s", quoteIdent(c.name), p))
+			}
+		}
+		if len(matches) == 0 {
+			return &Page{Events: []Row{}}, nil
+		}
+		where = append(where, "("+strings.Join(matches, " OR ")+")")
+	}
+	order, cmp := "ASC", ">"
+	if q.Desc {
+		order, cmp = "DESC", "<"
+	}
+	if q.Cursor != "" {
+		block, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, fmt.Sprintf(`("blockNumber", "id") %s (%s, %s)`, cmp, arg(block), arg(id)))
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	selects := make([]string, 0, len(cols)+1)
+	for _, c := range cols {
+		selects = append(selects, quoteIdent(c.name)+"::text")
+	}
+	// events are served with their transaction and call once enrichment has stored them
+	withTx, err := s.hasTable(ctx, "transactions")
+	if err != nil {
+		return nil, err
+	}
+	withCall, err := s.hasTable(ctx, "calls")
+	if err != nil {
+		return nil, err
+	}
+	if withTx {
+		selects = append(selects, fmt.Sprintf(txColumn, quoteIdent(table)))
+	}
+	if withCall {
+		selects = append(selects, fmt.Sprintf(callColumn, quoteIdent(table)))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ", "), quoteIdent(table))
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// fetch one extra row to know whether another page exists
+	query += fmt.Sprintf(` ORDER BY "blockNumber" %s, "id" %s LIMIT %d`, order, order, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &Page{Events: make([]Row, 0, limit)}
+	values := make([]sql.NullString, len(selects))
+	ptrs := make([]interface{}, len(selects))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(page.Events) == limit {
+			last := page.Events[limit-1]
+			block, _ := last["blockNumber"].(int64)
+			id, _ := last["id"].(int64)
+			page.NextCursor = encodeCursor(block, id)
+			break
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(Row, len(cols))
+		for i, c := range cols {
+			row[c.name] = convert(values[i], c.dataType)
+		}
+		extra := values[len(cols):]
+		if withTx {
+			if extra[0].Valid {
+				row["tx"] = json.RawMessage(extra[0].String)
+			}
+			extra = extra[1:]
+		}
+		if withCall && extra[0].Valid {
+			row["call"] = json.RawMessage(extra[0].String)
+		}
+		page.Events = append(page.Events, row)
+	}
+	return page, rows.Err()
+}
+
+// eventTable resolves q.Event to the table holding its rows through event_tables, written
+// by the indexer. Table names are used as is. An event written to several tables, such as
+// an ERC-721 Transfer next to an ERC-20 one, resolves to the table of q.Signature and
+// fails otherwise, naming its tables. Events missing from event_tables, or databases
+// without it, fall back to the lower-cased name.
+func (s *Store) eventTable(ctx context.Context, q Query) (string, error) {
+	fallback := strings.ToLower(q.Event)
+	registered, err := s.hasTable(ctx, "event_tables")
+	if err != nil || !registered {
+		return fallback, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT "table", "signature", "table" = $1 FROM event_tables
+		WHERE "table" = $1 OR "event" = $1 OR "signature" = $2 ORDER BY "table"`,
+		q.Event, strings.ReplaceAll(q.Event, " ", ""))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var tables, matching []string
+	for rows.Next() {
+		var table, signature string
+		var named bool
+		if err := rows.Scan(&table, &signature, &named); err != nil {
+			return "", err
+		}
+		if named {
+			return table, nil
+		}
+		if len(tables) == 0 || tables[len(tables)-1] != table {
+			tables = append(tables, table)
+		}
+		if signature == q.Signature && (len(matching) == 0 || matching[len(matching)-1] != table) {
+			matching = append(matching, table)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(matching) == 1 {
+		return matching[0], nil
+	}
+	switch len(tables) {
+	case 0:
+		return fallback, nil
+	case 1:
+		return tables[0], nil
+	}
+	return "", fmt.Errorf("%w: event %s is stored in the tables %s, query one of them by table name",
+		ErrInvalidQuery, q.Event, strings.Join(tables, ", "))
+}
+
+// txColumn selects the transaction of an event row as a JSON object, in the shape of
+// transactionRow. Integers stored as NUMERIC stay decimal strings.
+const txColumn = `(SELECT jsonb_build_object(
+	'from', t."from", 'to', t."to", 'nonce', t."nonce",
+	'gasPrice', t."gasPrice"::text, 'maxFeePerGas', t."maxFeePerGas"::text,
+	'effectiveGasPrice', t."effectiveGasPrice"::text,
+	'gasUsed', t."gasUsed", 'status', t."status")
+	FROM transactions t WHERE t."hash" = %s."txnHash")::text`
+
+// callColumn selects the decoded call of the transaction of an event row as a JSON object,
+// in the shape of callRow.
+const callColumn = `(SELECT jsonb_build_object(
+	'method', c."method", 'signature', c."signature", 'selector', c."selector",
+	'args', c."args", 'value', c."value"::text, 'success', c."success")
+	FROM calls c WHERE c."txnHash" = %s."txnHash")::text`
+
+// hasTable reports whether table, written by the enrichment, exists.
+func (s *Store) hasTable(ctx context.Context, table string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists)
+	return exists, err
+}
+
+// convert maps the text form of a column back to a JSON-friendly value.
+// NUMERIC columns (uint256) stay decimal strings so clients never lose precision.
+func convert(v sql.NullString, dataType string) interface{} {
+	if !v.Valid {
+		return nil
+	}
+	switch dataType {
+	case "smallint", "integer", "bigint":
+		if n, err := strconv.ParseInt(v.String, 10, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		return v.String == "true"
+	case "json", "jsonb":
+		// arrays and tuples are served as nested JSON
+		return json.RawMessage(v.String)
+	}
+	return v.String
+}
+
+func isTextType(dataType string) bool {
+	return dataType == "character varying" || dataType == "text" || dataType == "character"
+}
+
+// normalizeAddress returns the checksummed form of hex addresses, which is how the
+// indexer stores them, and leaves any other value untouched.
+func normalizeAddress(v string) string {
+	if common.IsHexAddress(v) {
+		return common.HexToAddress(v).Hex()
+	}
+	return v
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// encodeCursor returns an opaque cursor pointing after the row (block, id).
+func encodeCursor(block, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", block, id)))
+}
+
+func decodeCursor(cursor string) (int64, int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+	}
+	blockStr, idStr, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+	}
+	block, err := strconv.ParseInt(blockStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+	}
+	return block, id, nil
+}
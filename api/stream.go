@@ -0,0 +1,299 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/naman1402/geth-indexer/subsrciber"
+)
+
+const (
+	// clientBuffer is the number of events queued per client before it is disconnected.
+	clientBuffer = 256
+	// keepAliveInterval is how often a comment is sent to keep idle connections open.
+	keepAliveInterval = 15 * time.Second
+)
+
+// streamFilter selects which events a client receives.
+type streamFilter struct {
+	contract string
+	event    string
+	fields   map[string][]string
+}
+
+func (f streamFilter) match(row Row) bool {
+	if f.contract != "" && row["contract"] != normalizeAddress(f.contract) {
+		return false
+	}
+	if f.event != "" && !strings.EqualFold(fmt.Sprint(row["name"]), f.event) {
+		return false
+	}
+	for field, values := range f.fields {
+		v := fmt.Sprint(row[field])
+		found := false
+		for _, want := range values {
+			if v == normalizeAddress(want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type streamClient struct {
+	filter streamFilter
+	events chan Row
+	// overflow is closed when the client fell behind and was dropped by the hub
+	overflow chan struct{}
+}
+
+// Hub fans out committed events to connected stream clients. Publishing never blocks:
+// a client whose buffer is full is disconnected and can resume from its last cursor.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[*streamClient]struct{}
+}
+
+// NewHub returns an empty Hub.
+func NewHub() *Hub {
+	return &Hub{clients: make(map[*streamClient]struct{})}
+}
+
+// Publish sends the committed event with row id to every matching client.
+// It has the signature of indexer.CommitHook.
+func (h *Hub) Publish(id int64, e *subsrciber.Event) {
+	row := eventRow(id, e)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if !c.filter.match(row) {
+			continue
+		}
+		select {
+		case c.events <- row:
+		default:
+			// slow client, drop it rather than blocking the indexer
+			delete(h.clients, c)
+			close(c.overflow)
+		}
+	}
+}
+
+func (h *Hub) subscribe(filter streamFilter) *streamClient {
+	c := &streamClient{
+		filter:   filter,
+		events:   make(chan Row, clientBuffer),
+		overflow: make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+	return c
+}
+
+func (h *Hub) unsubscribe(c *streamClient) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+// eventRow converts a decoded event into the same shape as the rows served by the REST API.
+func eventRow(id int64, e *subsrciber.Event) Row {
+	row := Row{
+		"id":          id,
+		"name":        e.Name,
+		"blockNumber": int64(e.BlockNumber),
+		"txnHash":     e.TxnHash.Hex(),
+		"contract":    e.Contract.Hex(),
+		"logIndex":    int64(e.LogIndex),
+		"decodedBy":   e.DecodedBy,
+	}
+	for k, v := range e.Data {
+		row[k] = subsrciber.JSONValue(v)
+	}
+	if e.Tx != nil {
+		row["tx"] = transactionRow(e.Tx)
+		if e.Tx.Call != nil {
+			row["call"] = callRow(e.Tx)
+		}
+	}
+	return row
+}
+
+// callRow converts the decoded call of tx into the shape served by the REST API.
+func callRow(tx *subsrciber.Transaction) map[string]interface{} {
+	call := tx.Call
+	row := map[string]interface{}{
+		"method":    nil,
+		"signature": nil,
+		"selector":  nil,
+		"args":      nil,
+		"value":     tx.Value.String(),
+		"success":   tx.Status == 1,
+	}
+	if call.Method != "" {
+		row["method"], row["signature"] = call.Method, call.Signature
+	}
+	if call.Selector != "" {
+		row["selector"] = call.Selector
+	}
+	if call.Args != nil {
+		row["args"] = subsrciber.JSONValue(call.Args)
+	}
+	return row
+}
+
+// transactionRow converts the transaction of an event into the shape served by the REST API.
+func transactionRow(tx *subsrciber.Transaction) map[string]interface{} {
+	row := map[string]interface{}{
+		"from":              tx.From.Hex(),
+		"to":                nil,
+		"nonce":             tx.Nonce,
+		"gasPrice":          nil,
+		"maxFeePerGas":      nil,
+		"effectiveGasPrice": nil,
+		"gasUsed":           tx.GasUsed,
+		"status":            tx.Status,
+	}
+	if tx.To != nil {
+		row["to"] = tx.To.Hex()
+	}
+	if tx.GasPrice != nil {
+		row["gasPrice"] = tx.GasPrice.String()
+	}
+	if tx.MaxFeePerGas != nil {
+		row["maxFeePerGas"] = tx.MaxFeePerGas.String()
+	}
+	if tx.EffectiveGasPrice != nil {
+		row["effectiveGasPrice"] = tx.EffectiveGasPrice.String()
+	}
+	return row
+}
+
+// handleStream serves GET /stream as Server-Sent Events. Supported query parameters:
+//
+//	contract, event, cursor
+//
+// Any other parameter is treated as a filter on an event field, like GET /events/{event}.
+// When cursor (or the Last-Event-ID header) is set, rows of event committed after it are
+// replayed from the database before live events are sent.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	filter := streamFilter{fields: make(map[string][]string)}
+	cursor := r.Header.Get("Last-Event-ID")
+	for key, values := range r.URL.Query() {
+		switch key {
+		case "contract":
+			filter.contract = values[0]
+		case "event":
+			filter.event = values[0]
+		case "cursor":
+			cursor = values[0]
+		default:
+			filter.fields[key] = values
+		}
+	}
+	if cursor != "" && filter.event == "" {
+		writeError(w, http.StatusBadRequest, "cursor requires the event parameter")
+		return
+	}
+
+	// subscribe before replaying so nothing committed in between is missed
+	client := s.hub.subscribe(filter)
+	defer s.hub.unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	replayed := make(map[int64]bool)
+	for cursor != "" {
+		page, err := s.store.Events(r.Context(), Query{
+			Event:    filter.event,
+			Contract: filter.contract,
+			Fields:   filter.fields,
+			Cursor:   cursor,
+			Limit:    maxLimit,
+		})
+		if err != nil {
+			writeSSE(w, "error", "", map[string]string{"error": err.Error()})
+			return
+		}
+		for _, row := range page.Events {
+			id, _ := row["id"].(int64)
+			replayed[id] = true
+			if err := writeSSE(w, fmt.Sprint(row["name"]), rowCursorString(row), row); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		cursor = page.NextCursor
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.overflow:
+			writeSSE(w, "error", "", map[string]string{"error": "client too slow, reconnect with the last cursor"})
+			flusher.Flush()
+			return
+		case row := <-client.events:
+			id, _ := row["id"].(int64)
+			if replayed[id] {
+				// already sent during replay
+				delete(replayed, id)
+				continue
+			}
+			if err := writeSSE(w, fmt.Sprint(row["name"]), rowCursorString(row), row); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func rowCursorString(row Row) string {
+	block, _ := row["blockNumber"].(int64)
+	id, _ := row["id"].(int64)
+	return encodeCursor(block, id)
+}
+
+// writeSSE writes a single Server-Sent Event with a JSON payload.
+func writeSSE(w http.ResponseWriter, event, id string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("failed to encode stream event", "err", err)
+		return nil
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -1,46 +1,167 @@
 package cli
 
 import (
+	"errors"
+	"io/fs"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
 
+	"github.com/naman1402/geth-indexer/logging"
 	"github.com/spf13/viper"
 	"github.com/subosito/gotenv"
 )
 
+// Defaults returns the configuration used when no environment variable overrides it. It is
+// the starting point of configurations built in code, e.g. by the indexer package options.
+func Defaults() *Config {
+	return &Config{
+		Query: QueryFlagOptions{
+			Window: 2000,
+		},
+		Database: DatabaseConfig{
+			DBHost:     "localhost",
+			DBPort:     5432,
+			DBUser:     "postgres",
+			DBPassword: "postgres",
+			DBName:     "geth_indexer",
+		},
+		API: APIConfig{
+			EtherscanURL:  "https://api.etherscan.io/v2/api",
+			EtherscanURLs: map[int64]string{},
+			SourcifyURL:   "https://sourcify.dev/server",
+			BlockscoutURL: "https://eth.blockscout.com",
+			ChainID:       1,
+			Resolvers:     []string{"etherscan", "sourcify", "blockscout"},
+		},
+		Server: ServerConfig{
+			Addr:     ":8080",
+			GRPCAddr: ":9090",
+		},
+		Tracing: TracingConfig{
+			Insecure: true,
+		},
+		Log: logging.Config{
+			Format: "text",
+			Level:  "info",
+		},
+		ABI: ABIConfig{
+			CacheDir: ".abi-cache",
+		},
+		Enrich: EnrichConfig{
+			BatchSize: 100,
+			CacheSize: 10000,
+		},
+		Traces: CallTraceConfig{
+			Method: "debug_traceBlockByNumber",
+		},
+	}
+}
+
 // Run initializes the application configuration by reading the config.yaml file,
 // unmarshaling the configuration into a Config struct, and parsing any command-line flags.
 // It returns a pointer to the initialized Config struct.
 func Run() *Config {
 
 	_ = gotenv.Load()
+	d := Defaults()
 	dbConfig := DatabaseConfig{
-		DBHost:     getEnvOrDefault("DB_HOST", "localhost"),
-		DBPort:     getEnvAsIntOrDefault("DB_PORT", 5432),
-		DBUser:     getEnvOrDefault("DB_USER", "postgres"),
-		DBPassword: getEnvOrDefault("DB_PASSWORD", "postgres"),
-		DBName:     getEnvOrDefault("DB_NAME", "geth_indexer"),
+		DBHost:     getEnvOrDefault("DB_HOST", d.Database.DBHost),
+		DBPort:     getEnvAsIntOrDefault("DB_PORT", d.Database.DBPort),
+		DBUser:     getEnvOrDefault("DB_USER", d.Database.DBUser),
+		DBPassword: getEnvOrDefault("DB_PASSWORD", d.Database.DBPassword),
+		DBName:     getEnvOrDefault("DB_NAME", d.Database.DBName),
 	}
 
 	apiConfig := APIConfig{
-		EtherscanAPI: os.Getenv("ETHERSCAN_API_KEY"),
-		EthNodeURL:   os.Getenv("RPC_URL"),
+		EtherscanAPI:  os.Getenv("ETHERSCAN_API_KEY"),
+		EthNodeURL:    os.Getenv("RPC_URL"),
+		EtherscanURL:  getEnvOrDefault("ETHERSCAN_URL", d.API.EtherscanURL),
+		EtherscanURLs: parseChainURLs(os.Getenv("ETHERSCAN_URLS")),
+		SourcifyURL:   getEnvOrDefault("SOURCIFY_URL", d.API.SourcifyURL),
+		BlockscoutURL: getEnvOrDefault("BLOCKSCOUT_URL", d.API.BlockscoutURL),
+		ChainID:       int64(getEnvAsIntOrDefault("CHAIN_ID", int(d.API.ChainID))),
+		Resolvers:     strings.Split(getEnvOrDefault("ABI_RESOLVERS", strings.Join(d.API.Resolvers, ",")), ","),
 	}
 
 	queryConfig := QueryFlagOptions{
 		Address: os.Getenv("CONTRACT_ADDRESS"),
 		From:    getEnvAsIntOrDefault("START_BLOCK", 0),
 		To:      getEnvAsIntOrDefault("END_BLOCK", 0),
+		Window:  getEnvAsIntOrDefault("BACKFILL_WINDOW", d.Query.Window),
+	}
+	if filters := os.Getenv("EVENT_FILTERS"); filters != "" {
+		queryConfig.Filters = strings.Split(filters, ";")
+	}
+
+	serverConfig := ServerConfig{
+		Addr:         getEnvOrDefault("HTTP_ADDR", d.Server.Addr),
+		GRPCAddr:     getEnvOrDefault("GRPC_ADDR", d.Server.GRPCAddr),
+		MaxLagBlocks: getEnvAsIntOrDefault("MAX_LAG_BLOCKS", 0),
+	}
+
+	tracingConfig := TracingConfig{
+		Endpoint: os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		Insecure: getEnvOrDefault("OTEL_EXPORTER_OTLP_INSECURE", "true") == "true",
+	}
+
+	abiConfig := ABIConfig{
+		File:              os.Getenv("ABI_FILE"),
+		CacheDir:          getEnvOrDefault("ABI_CACHE_DIR", d.ABI.CacheDir),
+		SignatureFallback: getEnvOrDefault("ABI_SIGNATURE_FALLBACK", "false") == "true",
+	}
+	if extra := os.Getenv("ABI_EXTRA"); extra != "" {
+		abiConfig.Extra = strings.Split(extra, ";")
+	}
+	if getEnvOrDefault("ABI_CACHE", "true") != "true" {
+		abiConfig.CacheDir = ""
+	}
+	if sigs := os.Getenv("ABI_SIGNATURES"); sigs != "" {
+		abiConfig.Signatures = strings.Split(sigs, ";")
+	}
+
+	enrichConfig := EnrichConfig{
+		Transactions: getEnvOrDefault("ENRICH_TRANSACTIONS", "false") == "true",
+		Calls:        getEnvOrDefault("DECODE_CALLS", "false") == "true",
+		BatchSize:    getEnvAsIntOrDefault("ENRICH_BATCH_SIZE", d.Enrich.BatchSize),
+		CacheSize:    getEnvAsIntOrDefault("ENRICH_CACHE_SIZE", d.Enrich.CacheSize),
+	}
+
+	traceConfig := CallTraceConfig{
+		Enabled:  getEnvOrDefault("TRACE_CALLS", "false") == "true",
+		Method:   getEnvOrDefault("TRACE_METHOD", d.Traces.Method),
+		Fixtures: os.Getenv("TRACE_FIXTURES"),
+		Record:   os.Getenv("TRACE_RECORD"),
+	}
+	if addresses := os.Getenv("TRACE_ADDRESSES"); addresses != "" {
+		traceConfig.Addresses = strings.Split(addresses, ",")
+	}
+
+	logConfig := logging.Config{
+		Format:     getEnvOrDefault("LOG_FORMAT", d.Log.Format),
+		Level:      getEnvOrDefault("LOG_LEVEL", d.Log.Level),
+		Components: logging.ParseLevels(os.Getenv("LOG_LEVELS")),
 	}
 
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix("")
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
-	viper.SetConfigFile("config.yaml")
+	viper.SetConfigFile(getEnvOrDefault("CONFIG_FILE", "config.yaml"))
 	viper.AddConfigPath(".")
 
+	// the config file is optional, it holds the per-event expressions
+	var transforms []EventTransform
+	if err := viper.ReadInConfig(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("failed to read config file", "file", viper.ConfigFileUsed(), "err", err)
+		os.Exit(1)
+	}
+	if err := viper.UnmarshalKey("events", &transforms); err != nil {
+		slog.Error("invalid events in config file", "file", viper.ConfigFileUsed(), "err", err)
+		os.Exit(1)
+	}
+
 	// var config Config
 	// if err := viper.ReadInConfig(); err != nil {
 	// 	log.Printf("failed to read config file: %v\n", err)
@@ -55,6 +176,13 @@ func Run() *Config {
 		Query:    queryConfig,
 		Database: dbConfig,
 		API:      apiConfig,
+		Server:   serverConfig,
+		Tracing:  tracingConfig,
+		Log:      logConfig,
+		ABI:      abiConfig,
+		Events:   transforms,
+		Enrich:   enrichConfig,
+		Traces:   traceConfig,
 	}
 }
 
@@ -65,6 +193,24 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// parseChainURLs parses a list such as "137=https://api.polygonscan.com/api,56=https://api.bscscan.com/api"
+// into a map keyed by chain ID. Malformed entries are ignored.
+func parseChainURLs(s string) map[int64]string {
+	urls := make(map[int64]string)
+	for _, entry := range strings.Split(s, ",") {
+		id, url, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		chainID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil {
+			continue
+		}
+		urls[chainID] = strings.TrimSpace(url)
+	}
+	return urls
+}
+
 func getEnvAsIntOrDefault(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -1,6 +1,11 @@
 package cli
 
-import "flag"
+import (
+	"flag"
+	"log/slog"
+
+	"github.com/naman1402/geth-indexer/logging"
+)
 
 // Config holds the configuration options for the application.
 type Config struct {
@@ -10,6 +15,55 @@ type Config struct {
 	Database DatabaseConfig
 	// API holds the configuration for the API endpoints.
 	API APIConfig
+	// Server holds the configuration for the HTTP query server.
+	Server ServerConfig
+	// Tracing holds the configuration for OpenTelemetry tracing.
+	Tracing TracingConfig
+	// Log holds the logging format and levels.
+	Log logging.Config
+	// ABI holds local ABI sources used instead of Etherscan.
+	ABI ABIConfig
+	// Events holds the per-event expressions read from the config file.
+	Events []EventTransform `mapstructure:"events"`
+	// Enrich holds the options of transaction and receipt enrichment.
+	Enrich EnrichConfig
+	// Traces holds the options of internal call tracing.
+	Traces CallTraceConfig
+}
+
+// LogValue implements slog.LogValuer so the configuration can be logged without leaking
+// the Etherscan key, the database password or credentials embedded in the RPC URL.
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Group("query",
+			slog.String("address", c.Query.Address),
+			slog.Int("from", c.Query.From),
+			slog.Int("to", c.Query.To),
+			slog.Any("filters", c.Query.Filters),
+		),
+		slog.Group("database",
+			slog.String("host", c.Database.DBHost),
+			slog.Int("port", c.Database.DBPort),
+			slog.String("user", c.Database.DBUser),
+			slog.String("name", c.Database.DBName),
+		),
+		slog.Group("api",
+			slog.String("rpc_url", logging.RedactURL(c.API.EthNodeURL)),
+			slog.Bool("etherscan_key_set", c.API.EtherscanAPI != ""),
+			slog.Int64("chain_id", c.API.ChainID),
+			slog.Any("abi_resolvers", c.API.Resolvers),
+		),
+		slog.Bool("enrich_transactions", c.Enrich.Transactions),
+		slog.Bool("decode_calls", c.Enrich.Calls),
+		slog.Group("traces",
+			slog.Bool("enabled", c.Traces.Enabled),
+			slog.String("method", c.Traces.Method),
+			slog.Any("addresses", c.Traces.Addresses),
+			slog.String("fixtures", c.Traces.Fixtures),
+		),
+		slog.String("http_addr", c.Server.Addr),
+		slog.String("grpc_addr", c.Server.GRPCAddr),
+	)
 }
 
 // QueryFlagOptions holds the options for querying the smart contract.
@@ -20,6 +74,11 @@ type QueryFlagOptions struct {
 	From int
 	// To is the ending block number for the query.
 	To int
+	// Window is the number of blocks fetched per eth_getLogs call during backfills.
+	Window int
+	// Filters restrict indexed event arguments, e.g. "Transfer.to in [0xabc..., 0xdef...]".
+	// They are encoded into the eth_getLogs and subscription topics.
+	Filters []string
 }
 
 // DatabaseConfig holds the configuration for the database connection.
@@ -42,6 +101,115 @@ type APIConfig struct {
 	EtherscanAPI string `mapstructure:"etherscan"`
 	// EthNodeURL is the URL of the Ethereum node.
 	EthNodeURL string `mapstructure:"ethnode"`
+	// EtherscanURL is the base URL of the Etherscan V2 multichain API.
+	EtherscanURL string `mapstructure:"etherscanurl"`
+	// EtherscanURLs overrides EtherscanURL per chain ID, for Etherscan-compatible
+	// explorer forks.
+	EtherscanURLs map[int64]string `mapstructure:"etherscanurls"`
+	// SourcifyURL is the base URL of the Sourcify server.
+	SourcifyURL string `mapstructure:"sourcifyurl"`
+	// BlockscoutURL is the base URL of the Blockscout explorer.
+	BlockscoutURL string `mapstructure:"blockscouturl"`
+	// ChainID is the chain the contract is deployed on.
+	ChainID int64 `mapstructure:"chainid"`
+	// Resolvers lists the ABI resolvers to try, in order, e.g. ["etherscan", "sourcify"].
+	Resolvers []string `mapstructure:"resolvers"`
+}
+
+// ABIConfig selects a local source for the contract ABI. When neither field is set the
+// ABI is fetched from the resolvers in APIConfig.Resolvers.
+type ABIConfig struct {
+	// File is a path to an ABI JSON file or a Hardhat/Foundry artifact containing one.
+	File string `mapstructure:"file"`
+	// Signatures are human-readable event signatures, e.g.
+	// "Transfer(address indexed from, address indexed to, uint256 value)".
+	Signatures []string `mapstructure:"signatures"`
+	// Extra are ABI fragments merged into the decoder ABI: event signatures, or paths to ABI
+	// or artifact files. They take precedence over the contract ABI.
+	Extra []string `mapstructure:"extra"`
+	// SignatureFallback decodes logs missing from the ABI by matching them against a registry
+	// of standard event signatures, and lets the indexer start with the registry alone when no
+	// ABI can be loaded. It is off by default.
+	SignatureFallback bool `mapstructure:"signaturefallback"`
+	// CacheDir is the directory resolved ABIs are cached in. Empty disables the cache.
+	CacheDir string `mapstructure:"cachedir"`
+}
+
+// EventTransform filters and reshapes the decoded data of an event with expressions,
+// evaluated after decoding and before the event is indexed.
+type EventTransform struct {
+	// Event selects the events like the command line: name, overload name or signature.
+	Event string `mapstructure:"event"`
+	// Filter drops the event unless it evaluates to true, e.g. "value > 1e24 && from != to".
+	Filter string `mapstructure:"filter"`
+	// Fields are added to the event data, each computed from the decoded fields.
+	Fields []DerivedField `mapstructure:"fields"`
+	// Rename renames event fields, derived fields included.
+	Rename []FieldRename `mapstructure:"rename"`
+}
+
+// DerivedField is a field computed by an expression, e.g. amount = units(value, 6).
+type DerivedField struct {
+	Name string `mapstructure:"name"`
+	Expr string `mapstructure:"expr"`
+}
+
+// FieldRename renames the field From to To.
+type FieldRename struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+}
+
+// EnrichConfig enables fetching the transaction and receipt of every event.
+type EnrichConfig struct {
+	// Transactions adds the sender, recipient, nonce, gas and status of the transaction to
+	// events, stored in the transactions table.
+	Transactions bool `mapstructure:"transactions"`
+	// Calls scans every block of the indexed range for transactions sent to the contract,
+	// reverted ones included, and stores their calldata decoded with its ABI in the calls
+	// table. Events of those transactions get the call like Transactions.
+	Calls bool `mapstructure:"calls"`
+	// BatchSize is the number of transactions fetched per batched JSON-RPC call.
+	BatchSize int `mapstructure:"batch_size"`
+	// CacheSize is the number of transactions kept in memory.
+	CacheSize int `mapstructure:"cache_size"`
+}
+
+// CallTraceConfig enables indexing the internal calls and ether transfers touching the
+// contract, read from execution traces since they emit no log.
+type CallTraceConfig struct {
+	// Enabled stores the traced frames in the traces table.
+	Enabled bool `mapstructure:"enabled"`
+	// Method is the tracing API of the node: "debug_traceBlockByNumber" (callTracer) or
+	// "trace_filter" (Parity-style traces).
+	Method string `mapstructure:"method"`
+	// Addresses are traced besides the contract, e.g. a vault or a router calling it.
+	Addresses []string `mapstructure:"addresses"`
+	// Fixtures replays the JSON-RPC exchanges of a file, written by Record or by hand,
+	// instead of calling the node.
+	Fixtures string `mapstructure:"fixtures"`
+	// Record writes the JSON-RPC exchanges of the tracer to a file, to be replayed as
+	// Fixtures. It needs an http(s) RPC URL.
+	Record string `mapstructure:"record"`
+}
+
+// ServerConfig holds the configuration for the HTTP query server.
+type ServerConfig struct {
+	// Addr is the address the HTTP server listens on, e.g. ":8080".
+	Addr string `mapstructure:"addr"`
+	// GRPCAddr is the address the gRPC server listens on, e.g. ":9090".
+	GRPCAddr string `mapstructure:"grpc_addr"`
+	// MaxLagBlocks is the largest indexing lag (chain head minus last indexed block)
+	// reported as ready by /readyz. Zero disables the lag check.
+	MaxLagBlocks int `mapstructure:"max_lag_blocks"`
+}
+
+// TracingConfig holds the configuration for OpenTelemetry tracing.
+type TracingConfig struct {
+	// Endpoint is the OTLP/gRPC collector, as host:port or URL. Tracing is disabled when empty.
+	Endpoint string `mapstructure:"endpoint"`
+	// Insecure disables TLS towards the collector, as used by a local collector.
+	Insecure bool `mapstructure:"insecure"`
 }
 
 // ParseFlags parses the command-line flags and returns a QueryFlagOptions struct
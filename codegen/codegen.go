@@ -0,0 +1,350 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/naman1402/geth-indexer/logging"
+	"github.com/naman1402/geth-indexer/subsrciber"
+)
+
+var logger = logging.For("codegen")
+
+// Options configures Generate.
+type Options struct {
+	// Package is the name of the generated Go package.
+	Package string
+	// Dir is the directory the Go files are written to, created when missing.
+	Dir string
+	// MigrationsDir is the directory the SQL migrations are written to, none are written
+	// when it is empty.
+	MigrationsDir string
+	// Events selects the generated events like the indexer arguments: name, overload name
+	// or signature. Every ABI event is generated when it is empty.
+	Events []string
+	// Source describes where the ABI comes from, e.g. the contract address, in the header
+	// of the generated files.
+	Source string
+}
+
+// Generate writes typed bindings for the events of parsed to opts.Dir:
+//   - events.go: a struct per event, its topic0 and a decoder from types.Log
+//   - sink.go: a Sink interface with a method per event, Handle routing raw logs to it and
+//     Handlers registering it with indexer.New
+//
+// and, in opts.MigrationsDir, a migration creating the table the indexer writes each event
+// to. Migrations are numbered after the existing ones, and a table that already has a
+// migration is skipped. It returns the paths of the written files.
+func Generate(parsed abi.ABI, opts Options) ([]string, error) {
+	if !token.IsIdentifier(opts.Package) {
+		return nil, fmt.Errorf("invalid package name %q", opts.Package)
+	}
+	events := selectEvents(parsed, opts.Events)
+	if len(events) == 0 {
+		return nil, errors.New("no ABI event matches the requested events")
+	}
+
+	g := &generator{names: make(map[string]string)}
+	data := templateData{Package: opts.Package, Source: opts.Source, Module: module}
+	for _, e := range events {
+		data.Events = append(data.Events, g.event(e))
+	}
+	data.Structs, data.Big = g.structs, g.big
+	abiJSON, err := eventsJSON(events)
+	if err != nil {
+		return nil, err
+	}
+	data.ABI = string(abiJSON)
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	var written []string
+	for _, file := range []struct {
+		name string
+		tmpl *template.Template
+	}{{"events.go", eventsTemplate}, {"sink.go", sinkTemplate}} {
+		path := filepath.Join(opts.Dir, file.name)
+		if err := writeGo(path, file.tmpl, data); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+
+	if opts.MigrationsDir == "" {
+		return written, nil
+	}
+	migrations, err := writeMigrations(opts.MigrationsDir, events)
+	return append(written, migrations...), err
+}
+
+// module is the import path of the indexer, used by the generated sink.
+const module = "github.com/naman1402/geth-indexer"
+
+// selectEvents returns the ABI events selected by requested, all of them when it is empty,
+// in name order.
+func selectEvents(parsed abi.ABI, requested []string) []abi.Event {
+	var events []abi.Event
+	for _, e := range parsed.Events {
+		if len(requested) == 0 || subsrciber.EventRequested(requested, e) {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
+}
+
+// writeGo executes tmpl with data and writes the gofmt-ed result to path.
+func writeGo(path string, tmpl *template.Template, data templateData) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to generate %s: %w", path, err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format %s: %w", path, err)
+	}
+	return os.WriteFile(path, src, 0o644)
+}
+
+type templateData struct {
+	Package string
+	Source  string
+	Module  string
+	ABI     string
+	Events  []eventData
+	Structs []structData
+	// Big is set when a field is a *big.Int
+	Big bool
+}
+
+type eventData struct {
+	// Name is the Go name of the event struct, from the ABI name ("Transfer0").
+	Name      string
+	Signature string
+	Topic     string
+	Anonymous bool
+	Fields    []fieldData
+}
+
+type structData struct {
+	Name string
+	// Type is the ABI tuple type, e.g. "(address,uint256)".
+	Type   string
+	Fields []fieldData
+}
+
+type fieldData struct {
+	Name string
+	Type string
+	// Arg is the ABI argument or component name, the key of the value in Event.Data.
+	Arg string
+}
+
+// generator maps ABI types to Go types, declaring a struct per tuple type.
+type generator struct {
+	structs []structData
+	// names holds the declared Go names, mapped to their tuple type ("" for events)
+	names map[string]string
+	big   bool
+}
+
+// event builds the struct of e. Indexed strings, bytes, arrays and tuples are common.Hash:
+// only the keccak256 hash of the value is in the topic.
+func (g *generator) event(e abi.Event) eventData {
+	name := g.declare(abi.ToCamelCase(e.Name), "")
+	ev := eventData{Name: name, Signature: e.Sig, Topic: e.ID.Hex(), Anonymous: e.Anonymous}
+	taken := map[string]bool{"Raw": true}
+	for i, arg := range e.Inputs {
+		argName := subsrciber.ArgumentName(arg, i)
+		field := fieldData{Name: fieldName(argName, taken), Arg: argName}
+		if arg.Indexed && hashedTopic(arg.Type) {
+			field.Type = "common.Hash"
+		} else {
+			field.Type = g.goType(arg.Type, name+field.Name)
+		}
+		ev.Fields = append(ev.Fields, field)
+	}
+	return ev
+}
+
+// hashedTopic reports whether an indexed argument of type t is stored as the keccak256 hash
+// of its value.
+func hashedTopic(t abi.Type) bool {
+	switch t.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return true
+	}
+	return false
+}
+
+// goType returns the Go type go-ethereum unpacks t into. hint names the struct of a tuple
+// without a struct name in the ABI.
+func (g *generator) goType(t abi.Type, hint string) string {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		prefix := ""
+		if t.T == abi.UintTy {
+			prefix = "u"
+		}
+		switch t.Size {
+		case 8, 16, 32, 64:
+			return fmt.Sprintf("%sint%d", prefix, t.Size)
+		}
+		g.big = true
+		return "*big.Int"
+	case abi.BoolTy:
+		return "bool"
+	case abi.StringTy:
+		return "string"
+	case abi.AddressTy:
+		return "common.Address"
+	case abi.HashTy:
+		return "common.Hash"
+	case abi.BytesTy:
+		return "[]byte"
+	case abi.FixedBytesTy:
+		return fmt.Sprintf("[%d]byte", t.Size)
+	case abi.FunctionTy:
+		return "[24]byte"
+	case abi.SliceTy:
+		return "[]" + g.goType(*t.Elem, hint)
+	case abi.ArrayTy:
+		return fmt.Sprintf("[%d]%s", t.Size, g.goType(*t.Elem, hint))
+	case abi.TupleTy:
+		return g.tuple(t, hint)
+	default:
+		// fixed point numbers are not supported by go-ethereum
+		return "interface{}"
+	}
+}
+
+// tuple returns the struct declared for the tuple type t, declaring it on first use. The
+// struct is named after the Solidity struct when the ABI has its internal type.
+func (g *generator) tuple(t abi.Type, hint string) string {
+	name := hint
+	if t.TupleRawName != "" {
+		name = abi.ToCamelCase(t.TupleRawName)
+	}
+	if typ, ok := g.names[name]; ok && typ == t.String() {
+		return name
+	}
+	name = g.declare(name, t.String())
+
+	s := structData{Name: name, Type: t.String()}
+	taken := make(map[string]bool)
+	for i, elem := range t.TupleElems {
+		arg := t.TupleRawNames[i]
+		if arg == "" {
+			// unnamed components are keyed by position in Event.Data
+			arg = fmt.Sprint(i)
+		}
+		field := fieldData{Name: fieldName(arg, taken), Arg: arg}
+		field.Type = g.goType(*elem, name+field.Name)
+		s.Fields = append(s.Fields, field)
+	}
+	g.structs = append(g.structs, s)
+	return name
+}
+
+// declare reserves a Go type name for the tuple type typ, suffixing name when it is taken.
+func (g *generator) declare(name, typ string) string {
+	free := name
+	for i := 0; ; i++ {
+		if _, ok := g.names[free]; !ok {
+			break
+		}
+		free = fmt.Sprintf("%s%d", name, i)
+	}
+	g.names[free] = typ
+	return free
+}
+
+// fieldName returns the exported Go field name of an argument, unique among taken.
+func fieldName(arg string, taken map[string]bool) string {
+	name := abi.ToCamelCase(arg)
+	if !token.IsIdentifier(name) || !token.IsExported(name) {
+		name = "Field" + name
+	}
+	free := name
+	for i := 0; taken[free]; i++ {
+		free = fmt.Sprintf("%s%d", name, i)
+	}
+	taken[free] = true
+	return free
+}
+
+// jsonArgument is an argument in the JSON ABI format.
+type jsonArgument struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Indexed    bool           `json:"indexed,omitempty"`
+	Components []jsonArgument `json:"components,omitempty"`
+}
+
+type jsonEvent struct {
+	Type      string         `json:"type"`
+	Name      string         `json:"name"`
+	Anonymous bool           `json:"anonymous"`
+	Inputs    []jsonArgument `json:"inputs"`
+}
+
+// eventsJSON returns the JSON ABI of events embedded in the generated code. Unnamed
+// arguments are named like their columns, "arg<i>".
+func eventsJSON(events []abi.Event) ([]byte, error) {
+	out := make([]jsonEvent, 0, len(events))
+	for _, e := range events {
+		je := jsonEvent{Type: "event", Name: e.RawName, Anonymous: e.Anonymous, Inputs: []jsonArgument{}}
+		for i, arg := range e.Inputs {
+			typ, components := jsonType(arg.Type)
+			je.Inputs = append(je.Inputs, jsonArgument{
+				Name:       subsrciber.ArgumentName(arg, i),
+				Type:       typ,
+				Indexed:    arg.Indexed,
+				Components: components,
+			})
+		}
+		out = append(out, je)
+	}
+	return json.Marshal(out)
+}
+
+// jsonType returns the JSON ABI type of t and the components of its tuple, if any.
+func jsonType(t abi.Type) (string, []jsonArgument) {
+	switch t.T {
+	case abi.TupleTy:
+		components := make([]jsonArgument, 0, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			typ, sub := jsonType(*elem)
+			components = append(components, jsonArgument{Name: t.TupleRawNames[i], Type: typ, Components: sub})
+		}
+		return "tuple", components
+	case abi.SliceTy:
+		typ, components := jsonType(*t.Elem)
+		return typ + "[]", components
+	case abi.ArrayTy:
+		typ, components := jsonType(*t.Elem)
+		return fmt.Sprintf("%s[%d]", typ, t.Size), components
+	default:
+		return t.String(), nil
+	}
+}
+
+// quote returns s as a Go raw string literal, or an interpreted one when it contains a
+// backquote.
+func quote(s string) string {
+	if strings.Contains(s, "`") {
+		return fmt.Sprintf("%q", s)
+	}
+	return "`" + s + "`"
+}
@@ -0,0 +1,61 @@
+package codegen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/naman1402/geth-indexer/indexer"
+)
+
+// writeMigrations writes a migration creating the table of each event to dir, numbered after
+// the migrations already there (001_create_transfer_table.sql, ...). Tables that already have
+// a create migration are skipped, so running generate again only adds the new events.
+func writeMigrations(dir string, events []abi.Event) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	next := 1
+	existing := make(map[string]string)
+	for _, entry := range entries {
+		prefix, rest, ok := strings.Cut(entry.Name(), "_")
+		n, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			continue
+		}
+		if n >= next {
+			next = n + 1
+		}
+		existing[rest] = entry.Name()
+	}
+
+	var written []string
+	for _, e := range events {
+		table := strings.ToLower(e.Name)
+		name := fmt.Sprintf("create_%s_table.sql", table)
+		if file, ok := existing[name]; ok {
+			logger.Info("migration exists, skipping", "table", table, "file", file)
+			continue
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%03d_%s", next, name))
+		next++
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "-- Create the %s table for %s events, as the indexer does on the first one\n", table, e.Sig)
+		for _, stmt := range indexer.EventTableSQL(table, e.Inputs) {
+			b.WriteString(stmt + ";\n")
+		}
+		if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
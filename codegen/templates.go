@@ -0,0 +1,182 @@
+package codegen
+
+import "text/template"
+
+var funcs = template.FuncMap{"quote": quote}
+
+var eventsTemplate = template.Must(template.New("events").Funcs(funcs).Parse(`// Code generated by geth-indexer generate{{if .Source}} from the ABI of {{.Source}}{{end}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"errors"
+	"fmt"
+{{- if .Big}}
+	"math/big"
+{{- end}}
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ABI is the JSON ABI of the generated events. Unnamed arguments are named arg<i>, like
+// their columns.
+const ABI = {{quote .ABI}}
+
+// ErrEventMismatch is returned when a log is decoded as an event it is not an instance of.
+var ErrEventMismatch = errors.New("log does not match the event")
+
+var parsedABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(ABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+{{range .Structs}}
+// {{.Name}} is the {{.Type}} tuple.
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} ` + "`" + `abi:"{{.Arg}}"` + "`" + `
+{{- end}}
+}
+{{end}}
+{{- range .Events}}
+// {{.Name}} is the {{if .Anonymous}}anonymous {{end}}{{.Signature}} event.
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} ` + "`" + `abi:"{{.Arg}}"` + "`" + `
+{{- end}}
+	// Raw is the log the event was decoded from.
+	Raw types.Log ` + "`" + `abi:"-"` + "`" + `
+}
+
+// {{.Name}}Topic is the {{if .Anonymous}}hash of the signature of {{.Name}}, which is not logged{{else}}topic0 of {{.Name}} logs{{end}}.
+var {{.Name}}Topic = common.HexToHash("{{.Topic}}")
+
+// Decode{{.Name}} decodes a log of the {{.Name}} event.
+func Decode{{.Name}}(log types.Log) (*{{.Name}}, error) {
+	{{if .Fields}}values{{else}}_{{end}}, err := unpackLog({{.Name}}Topic, log)
+	if err != nil {
+		return nil, fmt.Errorf("decode {{.Name}}: %w", err)
+	}
+	e := &{{.Name}}{Raw: log}
+{{- range $i, $f := .Fields}}
+	e.{{$f.Name}} = *abi.ConvertType(values[{{$i}}], new({{$f.Type}})).(*{{$f.Type}})
+{{- end}}
+	return e, nil
+}
+{{end}}
+// unpackLog returns the values of the arguments of the event with the given ID, in ABI
+// order. Indexed strings, bytes, arrays and tuples are the hash in their topic.
+func unpackLog(id common.Hash, log types.Log) ([]interface{}, error) {
+	event, err := parsedABI.EventByID(id)
+	if err != nil {
+		return nil, err
+	}
+	topics := log.Topics
+	if !event.Anonymous {
+		if len(topics) == 0 || topics[0] != id {
+			return nil, ErrEventMismatch
+		}
+		topics = topics[1:]
+	}
+	data, err := event.Inputs.NonIndexed().Unpack(log.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, 0, len(event.Inputs))
+	for _, arg := range event.Inputs {
+		if !arg.Indexed {
+			values, data = append(values, data[0]), data[1:]
+			continue
+		}
+		if len(topics) == 0 {
+			return nil, ErrEventMismatch
+		}
+		topic := topics[0]
+		topics = topics[1:]
+		switch arg.Type.T {
+		case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+			values = append(values, topic)
+			continue
+		}
+		value, err := abi.Arguments{{"{{"}}Type: arg.Type{{"}}"}}.Unpack(topic.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg.Name, err)
+		}
+		values = append(values, value[0])
+	}
+	if len(topics) != 0 {
+		return nil, ErrEventMismatch
+	}
+	return values, nil
+}
+`))
+
+var sinkTemplate = template.Must(template.New("sink").Funcs(funcs).Parse(`// Code generated by geth-indexer generate{{if .Source}} from the ABI of {{.Source}}{{end}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"{{.Module}}/indexer"
+	"{{.Module}}/subsrciber"
+)
+
+// Sink handles the decoded events. Embed UnimplementedSink to handle only some of them.
+type Sink interface {
+{{- range .Events}}
+	On{{.Name}}(ctx context.Context, e *{{.Name}}) error
+{{- end}}
+}
+
+// UnimplementedSink ignores every event.
+type UnimplementedSink struct{}
+{{range .Events}}
+// On{{.Name}} ignores e.
+func (UnimplementedSink) On{{.Name}}(ctx context.Context, e *{{.Name}}) error { return nil }
+{{end}}
+// Handle decodes log and passes it to the sink method of its event. Logs of other events
+// and of anonymous events are ignored.
+func Handle(ctx context.Context, sink Sink, log types.Log) error {
+	if len(log.Topics) == 0 {
+		return nil
+	}
+	switch log.Topics[0] {
+{{- range .Events}}{{if not .Anonymous}}
+	case {{.Name}}Topic:
+		e, err := Decode{{.Name}}(log)
+		if err != nil {
+			return err
+		}
+		return sink.On{{.Name}}(ctx, e)
+{{- end}}{{end}}
+	}
+	return nil
+}
+
+// Handlers returns the options of indexer.New requesting every generated event and passing
+// it to sink. The Raw log of these events only holds its position: contract, block,
+// transaction and log index.
+func Handlers(sink Sink) []indexer.Option {
+	return []indexer.Option{
+{{- range .Events}}
+		indexer.OnEvent("{{.Signature}}", func(ctx context.Context, e *subsrciber.Event, v {{.Name}}) error {
+			v.Raw = rawLog(e)
+			return sink.On{{.Name}}(ctx, &v)
+		}),
+{{- end}}
+	}
+}
+
+// rawLog returns the position of the log e was decoded from.
+func rawLog(e *subsrciber.Event) types.Log {
+	return types.Log{Address: e.Contract, BlockNumber: e.BlockNumber, TxHash: e.TxnHash, Index: e.LogIndex}
+}
+`))
@@ -1,33 +1,41 @@
 package indexer
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 	_ "github.com/lib/pq"
 
 	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/logging"
+	"github.com/naman1402/geth-indexer/subsrciber"
 )
 
+var logger = logging.For("indexer")
+
 func Connect(options cli.DatabaseConfig) (*sql.DB, error) {
 
 	postgreSQLInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", options.DBHost, options.DBPort, options.DBUser, options.DBPassword, options.DBName)
 	db, err := sql.Open("postgres", postgreSQLInfo)
 	if err != nil {
-		log.Printf("failed to connect to database: %s", err)
+		logger.Error("failed to connect to database", "err", err)
 		return nil, err
 	}
 	err = db.Ping()
 	if err != nil {
-		log.Printf("Failed to ping database: %s", err)
+		logger.Error("failed to ping database", "err", err)
 		return nil, err
 	}
-	fmt.Printf("Ping successful: connected to the database %s and port %d\n", options.DBName, options.DBPort)
+	logger.Info("connected to the database", "host", options.DBHost, "port", options.DBPort, "name", options.DBName)
 
 	// Create transfer table if it doesn't exist
 	if err := createTransferTable(db); err != nil {
-		log.Printf("Warning: failed to create transfer table: %v", err)
+		logger.Warn("failed to create transfer table", "err", err)
 	}
 
 	return db, nil
@@ -44,6 +52,8 @@ func createTransferTable(db *sql.DB) error {
 		"from" VARCHAR(42) NOT NULL,
 		"to" VARCHAR(42) NOT NULL,
 		"value" NUMERIC NOT NULL,
+		"decodedBy" VARCHAR(16) NOT NULL DEFAULT 'abi',
+		"logIndex" INTEGER,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		UNIQUE("txnHash", "contract", "from", "to", "value")
 	);`
@@ -53,6 +63,14 @@ func createTransferTable(db *sql.DB) error {
 		return fmt.Errorf("failed to create transfer table: %v", err)
 	}
 
+	// Tables created before migrations/002 and 003 lack the decodedBy and logIndex columns
+	if _, err := db.Exec(`ALTER TABLE transfer ADD COLUMN IF NOT EXISTS "decodedBy" VARCHAR(16) NOT NULL DEFAULT 'abi'`); err != nil {
+		return fmt.Errorf("failed to add decodedBy column: %v", err)
+	}
+	if _, err := db.Exec(`ALTER TABLE transfer ADD COLUMN IF NOT EXISTS "logIndex" INTEGER`); err != nil {
+		return fmt.Errorf("failed to add logIndex column: %v", err)
+	}
+
 	// Create indexes for better performance
 	indexes := []string{
 		`CREATE INDEX IF NOT EXISTS idx_transfer_contract ON transfer("contract")`,
@@ -64,20 +82,416 @@ func createTransferTable(db *sql.DB) error {
 
 	for _, indexQuery := range indexes {
 		if _, err := db.Exec(indexQuery); err != nil {
-			log.Printf("Warning: failed to create index: %v", err)
+			logger.Warn("failed to create index", "query", indexQuery, "err", err)
+		}
+	}
+
+	logger.Info("transfer table and indexes created")
+	return nil
+}
+
+// createEventTable creates the table of an event from its ABI arguments when it does not
+// exist yet. Rows are unique per log, by transaction hash and log index.
+func createEventTable(ctx context.Context, db *sql.DB, table string, inputs abi.Arguments) error {
+	create, indexes := eventTable(table, inputs)
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("failed to create %s table: %v", table, err)
+	}
+	// fields derived by event expressions may be added to the config after the table exists
+	for i, arg := range inputs {
+		query := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s`, quoteIdent(table), quoteIdent(subsrciber.ArgumentName(arg, i)), columnType(arg))
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to add column to %s table: %v", table, err)
+		}
+	}
+
+	for _, indexQuery := range indexes {
+		if _, err := db.ExecContext(ctx, indexQuery); err != nil {
+			logger.Warn("failed to create index", "query", indexQuery, "err", err)
+		}
+	}
+	return nil
+}
+
+// eventTableFor returns the table of an event decoded with the given arguments: its
+// lower-cased name, unless a table of that name already holds another layout of the event
+// (an ERC-721 Transfer next to an ERC-20 one, arguments changed by a proxy upgrade). Such a
+// layout is written to a table of its own, suffixed with a hash of its columns, e.g.
+// transfer_1f2e3d4c. Columns added to the event, like derived fields, keep the table.
+func eventTableFor(ctx context.Context, db *sql.DB, name string, inputs abi.Arguments) (string, error) {
+	table := strings.ToLower(name)
+	existing, err := tableColumns(ctx, db, table)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s columns: %v", table, err)
+	}
+	if len(existing) == 0 || layoutFits(existing, inputs) {
+		return table, nil
+	}
+	own := table + "_" + hexutil.Encode(crypto.Keccak256([]byte(eventLayout(inputs)))[:4])[2:]
+	logger.Warn("event layout differs from its table, writing to a table of its own", "event", name, "table", own)
+	return own, nil
+}
+
+// createEventTablesTable creates the event_tables table, recording the table of every event
+// written, so the query APIs resolve an event to its tables, tables of its own included.
+// See migrations/008_create_event_tables_table.sql.
+func createEventTablesTable(ctx context.Context, db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS event_tables (
+		"table" VARCHAR(63) NOT NULL,
+		"event" VARCHAR(100) NOT NULL,
+		"signature" TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY ("table", "signature")
+	);`
+	if _, err := db.ExecContext(ctx, createTableQuery); err != nil {
+		return fmt.Errorf("failed to create event_tables table: %v", err)
+	}
+	indexQuery := `CREATE INDEX IF NOT EXISTS idx_event_tables_event ON event_tables("event")`
+	if _, err := db.ExecContext(ctx, indexQuery); err != nil {
+		logger.Warn("failed to create index", "query", indexQuery, "err", err)
+	}
+	return nil
+}
+
+// registerEventTable records that table holds the events named name with signature, once
+// per table and signature.
+func registerEventTable(ctx context.Context, db *sql.DB, table, name, signature string) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO event_tables ("table", "event", "signature")
+		VALUES ($1, $2, $3) ON CONFLICT ("table", "signature") DO NOTHING`, table, name, signature)
+	return err
+}
+
+// eventLayout describes the columns of an event decoded with inputs, e.g.
+// "from varchar(42),to varchar(42),value numeric".
+func eventLayout(inputs abi.Arguments) string {
+	cols := make([]string, len(inputs))
+	for i, arg := range inputs {
+		cols[i] = subsrciber.ArgumentName(arg, i) + " " + strings.ToLower(columnType(arg))
+	}
+	return strings.Join(cols, ",")
+}
+
+// eventColumns are the columns every event table has besides the event arguments.
+var eventColumns = map[string]bool{
+	"id": true, "name": true, "blockNumber": true, "txnHash": true, "logIndex": true,
+	"contract": true, "decodedBy": true, "created_at": true,
+}
+
+// layoutFits reports whether events decoded with inputs can be written to a table with the
+// existing columns: shared columns have the same type, and either the event or the table
+// has no column the other lacks. Missing columns are then added by createEventTable or
+// left NULL.
+func layoutFits(existing map[string]string, inputs abi.Arguments) bool {
+	args := make(map[string]bool, len(inputs))
+	missing := false
+	for i, arg := range inputs {
+		col := subsrciber.ArgumentName(arg, i)
+		args[col] = true
+		typ, ok := existing[col]
+		if !ok {
+			missing = true
+			continue
+		}
+		if typ != strings.Replace(strings.ToLower(columnType(arg)), "varchar", "character varying", 1) {
+			return false
+		}
+	}
+	if !missing {
+		return true
+	}
+	for col := range existing {
+		if !eventColumns[col] && !args[col] {
+			return false
+		}
+	}
+	return true
+}
+
+// tableColumns returns the type of every column of table, e.g. "character varying(42)", or
+// nil when it does not exist.
+func tableColumns(ctx context.Context, db *sql.DB, table string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT column_name, data_type, character_maximum_length
+		FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols map[string]string
+	for rows.Next() {
+		var name, typ string
+		var length sql.NullInt64
+		if err := rows.Scan(&name, &typ, &length); err != nil {
+			return nil, err
+		}
+		if length.Valid {
+			typ = fmt.Sprintf("%s(%d)", typ, length.Int64)
+		}
+		if cols == nil {
+			cols = make(map[string]string)
+		}
+		cols[name] = typ
+	}
+	return cols, rows.Err()
+}
+
+// EventTableSQL returns the statements creating the table of an event and its indexes, the
+// ones run by the indexer on the first event, e.g. to write them to a migration file. The
+// table of an event is its lower-cased ABI name, see eventTableFor for the exceptions.
+func EventTableSQL(table string, inputs abi.Arguments) []string {
+	create, indexes := eventTable(table, inputs)
+	return append([]string{create}, indexes...)
+}
+
+// eventTable builds the CREATE TABLE and CREATE INDEX statements of an event table.
+func eventTable(table string, inputs abi.Arguments) (string, []string) {
+	cols := []string{
+		`id SERIAL PRIMARY KEY`,
+		`"name" VARCHAR(100) NOT NULL`,
+		`"blockNumber" BIGINT NOT NULL`,
+		`"txnHash" VARCHAR(66) NOT NULL`,
+		`"logIndex" INTEGER NOT NULL`,
+		`"contract" VARCHAR(42) NOT NULL`,
+		`"decodedBy" VARCHAR(16) NOT NULL DEFAULT 'abi'`,
+	}
+	for i, arg := range inputs {
+		cols = append(cols, fmt.Sprintf(`%s %s`, quoteIdent(subsrciber.ArgumentName(arg, i)), columnType(arg)))
+	}
+	cols = append(cols,
+		`created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP`,
+		`UNIQUE("txnHash", "logIndex")`)
+
+	// event names such as Order or Check are reserved words, so the table is always quoted
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t%s\n)", quoteIdent(table), strings.Join(cols, ",\n\t"))
+	indexes := []string{
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s("contract")`, quoteIdent("idx_"+table+"_contract"), quoteIdent(table)),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s("blockNumber")`, quoteIdent("idx_"+table+"_block"), quoteIdent(table)),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s("txnHash")`, quoteIdent("idx_"+table+"_txn"), quoteIdent(table)),
+	}
+	return create, indexes
+}
+
+// quoteIdent quotes a table or column name for Postgres.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// createTransactionsTable creates the transactions table shared by every event table, joined
+// on "txnHash" = "hash". See migrations/004_create_transactions_table.sql.
+func createTransactionsTable(ctx context.Context, db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS transactions (
+		"hash" VARCHAR(66) PRIMARY KEY,
+		"blockNumber" BIGINT NOT NULL,
+		"from" VARCHAR(42) NOT NULL,
+		"to" VARCHAR(42),
+		"nonce" BIGINT NOT NULL,
+		"gasPrice" NUMERIC,
+		"maxFeePerGas" NUMERIC,
+		"effectiveGasPrice" NUMERIC,
+		"gasUsed" BIGINT NOT NULL,
+		"status" SMALLINT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.ExecContext(ctx, createTableQuery); err != nil {
+		return fmt.Errorf("failed to create transactions table: %v", err)
+	}
+	// Tables created before migrations/007 lack the maxFeePerGas column
+	if _, err := db.ExecContext(ctx, `ALTER TABLE transactions ADD COLUMN IF NOT EXISTS "maxFeePerGas" NUMERIC`); err != nil {
+		return fmt.Errorf("failed to add maxFeePerGas column: %v", err)
+	}
+
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_transactions_from ON transactions("from")`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_block ON transactions("blockNumber")`,
+	}
+	for _, indexQuery := range indexes {
+		if _, err := db.ExecContext(ctx, indexQuery); err != nil {
+			logger.Warn("failed to create index", "query", indexQuery, "err", err)
+		}
+	}
+	return nil
+}
+
+// insertTransaction stores tx, once per hash.
+func insertTransaction(ctx context.Context, db *sql.DB, tx *subsrciber.Transaction) error {
+	var to, gasPrice, maxFeePerGas, effectiveGasPrice interface{}
+	if tx.To != nil {
+		to = tx.To.Hex()
+	}
+	if tx.GasPrice != nil {
+		gasPrice = tx.GasPrice.String()
+	}
+	if tx.MaxFeePerGas != nil {
+		maxFeePerGas = tx.MaxFeePerGas.String()
+	}
+	if tx.EffectiveGasPrice != nil {
+		effectiveGasPrice = tx.EffectiveGasPrice.String()
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO transactions
+		("hash", "blockNumber", "from", "to", "nonce", "gasPrice", "maxFeePerGas", "effectiveGasPrice", "gasUsed", "status")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT ("hash") DO NOTHING`,
+		tx.Hash.Hex(), tx.BlockNumber, tx.From.Hex(), to, tx.Nonce,
+		gasPrice, maxFeePerGas, effectiveGasPrice, tx.GasUsed, tx.Status)
+	return err
+}
+
+// createCallsTable creates the calls table, one row per transaction sent to the contract,
+// joined with the event tables on "txnHash". See migrations/005_create_calls_table.sql.
+func createCallsTable(ctx context.Context, db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS calls (
+		"txnHash" VARCHAR(66) PRIMARY KEY,
+		"blockNumber" BIGINT NOT NULL,
+		"contract" VARCHAR(42) NOT NULL,
+		"from" VARCHAR(42) NOT NULL,
+		"method" VARCHAR(100),
+		"signature" TEXT,
+		"selector" VARCHAR(10),
+		"args" JSONB,
+		"value" NUMERIC NOT NULL,
+		"success" BOOLEAN NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.ExecContext(ctx, createTableQuery); err != nil {
+		return fmt.Errorf("failed to create calls table: %v", err)
+	}
+
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_calls_method ON calls("method")`,
+		`CREATE INDEX IF NOT EXISTS idx_calls_block ON calls("blockNumber")`,
+	}
+	for _, indexQuery := range indexes {
+		if _, err := db.ExecContext(ctx, indexQuery); err != nil {
+			logger.Warn("failed to create index", "query", indexQuery, "err", err)
 		}
 	}
+	return nil
+}
+
+// insertCall stores the decoded call of tx, once per transaction. Unknown methods and
+// selectors are stored as NULL.
+func insertCall(ctx context.Context, db *sql.DB, tx *subsrciber.Transaction) error {
+	call := tx.Call
+	var method, signature, selector, args interface{}
+	if call.Method != "" {
+		method, signature = call.Method, call.Signature
+	}
+	if call.Selector != "" {
+		selector = call.Selector
+	}
+	if call.Args != nil {
+		args = columnValue(call.Args)
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO calls
+		("txnHash", "blockNumber", "contract", "from", "method", "signature", "selector", "args", "value", "success")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT ("txnHash") DO NOTHING`,
+		tx.Hash.Hex(), tx.BlockNumber, tx.To.Hex(), tx.From.Hex(), method, signature, selector, args,
+		tx.Value.String(), tx.Status == 1)
+	return err
+}
+
+// createTracesTable creates the traces table, one row per frame of a call tree sent from or
+// to a traced address. See migrations/006_create_traces_table.sql.
+func createTracesTable(ctx context.Context, db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS traces (
+		id SERIAL PRIMARY KEY,
+		"blockNumber" BIGINT NOT NULL,
+		"txnHash" VARCHAR(66) NOT NULL,
+		"traceAddress" TEXT NOT NULL,
+		"type" VARCHAR(16) NOT NULL,
+		"from" VARCHAR(42) NOT NULL,
+		"to" VARCHAR(42) NOT NULL,
+		"value" NUMERIC NOT NULL,
+		"gas" BIGINT NOT NULL,
+		"gasUsed" BIGINT NOT NULL,
+		"input" TEXT,
+		"method" VARCHAR(100),
+		"args" JSONB,
+		"error" TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE ("txnHash", "traceAddress")
+	);`
+	if _, err := db.ExecContext(ctx, createTableQuery); err != nil {
+		return fmt.Errorf("failed to create traces table: %v", err)
+	}
 
-	log.Println("Transfer table and indexes created successfully")
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_traces_block ON traces("blockNumber")`,
+		`CREATE INDEX IF NOT EXISTS idx_traces_from ON traces("from")`,
+		`CREATE INDEX IF NOT EXISTS idx_traces_to ON traces("to")`,
+	}
+	for _, indexQuery := range indexes {
+		if _, err := db.ExecContext(ctx, indexQuery); err != nil {
+			logger.Warn("failed to create index", "query", indexQuery, "err", err)
+		}
+	}
 	return nil
 }
 
-// executeQuery executes a parameterized query with the provided args.
-func executeQuery(db *sql.DB, query string, args ...interface{}) {
-	_, err := db.Exec(query, args...)
+// insertTrace stores tr, once per position in the call tree of its transaction. The input
+// is stored as hex, the decoded call as method and args when known.
+func insertTrace(ctx context.Context, db *sql.DB, tr *subsrciber.Trace) error {
+	var input, method, args, traceErr interface{}
+	if len(tr.Input) > 0 {
+		input = hexutil.Encode(tr.Input)
+	}
+	if tr.Call != nil && tr.Call.Method != "" {
+		method = tr.Call.Method
+	}
+	if tr.Call != nil && tr.Call.Args != nil {
+		args = columnValue(tr.Call.Args)
+	}
+	if tr.Error != "" {
+		traceErr = tr.Error
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO traces
+		("blockNumber", "txnHash", "traceAddress", "type", "from", "to", "value", "gas", "gasUsed", "input", "method", "args", "error")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) ON CONFLICT ("txnHash", "traceAddress") DO NOTHING`,
+		tr.BlockNumber, tr.TxnHash.Hex(), tr.Path(), tr.Type, tr.From.Hex(), tr.To.Hex(), tr.Value.String(),
+		tr.Gas, tr.GasUsed, input, method, args, traceErr)
+	return err
+}
+
+// columnType maps an ABI argument to the Postgres type of its decoded value.
+func columnType(arg abi.Argument) string {
+	switch arg.Type.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		if arg.Indexed {
+			// only the keccak256 hash is in the topic
+			return "VARCHAR(66)"
+		}
+	}
+	switch arg.Type.T {
+	case abi.IntTy, abi.UintTy, abi.FixedPointTy:
+		// fixed point values are decimals derived by event expressions
+		return "NUMERIC"
+	case abi.AddressTy:
+		return "VARCHAR(42)"
+	case abi.BoolTy:
+		return "BOOLEAN"
+	case abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return "JSONB"
+	default:
+		return "TEXT"
+	}
+}
+
+// executeQuery executes a parameterized INSERT ... RETURNING "id" with the provided args.
+// It reports false when nothing was inserted because the row already exists (ON CONFLICT DO NOTHING).
+func executeQuery(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int64, bool, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
 	if err != nil {
-		log.Println("failed to execute query:", query, err)
+		logger.Error("failed to execute query", "query", query, "err", err)
+		return 0, false, err
 	}
+	return id, true, nil
 }
 
 // func indexingCheck(db *sql.DB, relation, column string) {
@@ -0,0 +1,47 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/naman1402/geth-indexer/subsrciber"
+)
+
+// handler is a registered event handler, fn decodes the event before calling the user function.
+type handler struct {
+	event string
+	fn    func(ctx context.Context, e *subsrciber.Event) error
+}
+
+// OnEvent registers fn for event, selected like WithEvents (name, overload name or
+// signature), and requests the event. Each event is decoded into a T with Event.Decode, so
+// T is a struct whose fields are tagged with the event argument names:
+//
+//	type Transfer struct {
+//		From  common.Address `abi:"from"`
+//		To    common.Address `abi:"to"`
+//		Value *big.Int       `abi:"value"`
+//	}
+//
+// e carries the log metadata (block, transaction, log index). An error returned by fn, or a
+// failure to decode the event, stops Run.
+func OnEvent[T any](event string, fn func(ctx context.Context, e *subsrciber.Event, v T) error) Option {
+	return func(ix *Indexer) error {
+		if t := reflect.TypeOf((*T)(nil)).Elem(); t.Kind() != reflect.Struct {
+			return fmt.Errorf("OnEvent %s: %s is not a struct", event, t)
+		}
+		ix.addEvents(event)
+		ix.handlers = append(ix.handlers, handler{
+			event: event,
+			fn: func(ctx context.Context, e *subsrciber.Event) error {
+				var v T
+				if err := e.Decode(&v); err != nil {
+					return err
+				}
+				return fn(ctx, e, v)
+			},
+		})
+		return nil
+	}
+}
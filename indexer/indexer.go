@@ -1,33 +1,205 @@
 package indexer
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"log"
-	"math/big"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/naman1402/geth-indexer/metrics"
 	"github.com/naman1402/geth-indexer/subsrciber"
+	"github.com/naman1402/geth-indexer/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Index is the main function that listens for events on the eventCh channel, generates SQL queries
-// using the generateQuery function, and executes those queries asynchronously using the executeQuery function.
-// The function runs in an infinite loop, waiting for events or a quit signal on the quit channel.
-// When a quit signal is received, the function returns.
-func Index(eventCh chan *subsrciber.Event, db *sql.DB, quit chan bool) {
-
-	for {
-		select {
-		case e := <-eventCh:
-			query, args := generateQuery(strings.ToLower(e.Name), e)
-			// log.Printf("[Index] received event from eventCh, creating query and executing it. Query: %s, Args: %v", query, args)
-			log.Printf("[Index] received event from eventCh, creating query and executing it")
-			go executeQuery(db, query, args...)
-		case q := <-quit:
-			if q {
-				return
+var tracer = tracing.Tracer("indexer")
+
+// CommitHook is called after an event has been inserted, with the id of the new row.
+// It is not called for duplicates. Hooks run on the insert goroutine and must not block.
+type CommitHook func(id int64, e *subsrciber.Event)
+
+// writer stores events in Postgres, one table per event (and overload) created on its first
+// event. Inserts run asynchronously and every hook is called once the event is committed.
+type writer struct {
+	db    *sql.DB
+	hooks []CommitHook
+	// tables already checked
+	tables map[string]bool
+	// table of every event layout already written, see eventTableFor
+	layouts  map[string]string
+	inflight sync.WaitGroup
+}
+
+func newWriter(db *sql.DB) *writer {
+	return &writer{db: db, tables: make(map[string]bool), layouts: make(map[string]string)}
+}
+
+// write generates the INSERT for e with generateQuery and executes it in the background
+// with executeQuery.
+func (w *writer) write(e *subsrciber.Event) {
+	layout := e.Name + "(" + eventLayout(e.Inputs) + ")"
+	table, ok := w.layouts[layout]
+	if !ok {
+		var err error
+		if table, err = eventTableFor(context.Background(), w.db, e.Name, e.Inputs); err != nil {
+			logger.Error("failed to check event table", "event", e.Name, "err", err)
+			table = strings.ToLower(e.Name)
+		}
+	}
+	if !w.tables[table] {
+		if err := createEventTable(context.Background(), w.db, table, e.Inputs); err != nil {
+			logger.Error("failed to create event table", "table", table, "err", err)
+		} else {
+			w.tables[table] = true
+		}
+	}
+	if w.tables[table] && !ok {
+		w.layouts[layout] = table
+		w.registerTable(table, e)
+	}
+	if e.Tx != nil && !w.tables["transactions"] {
+		if err := createTransactionsTable(context.Background(), w.db); err != nil {
+			logger.Error("failed to create transactions table", "err", err)
+		} else {
+			w.tables["transactions"] = true
+		}
+	}
+	query, args := generateQuery(table, e)
+	// log.Printf("[Index] received event from eventCh, creating query and executing it. Query: %s, Args: %v", query, args)
+	logger.Debug("received event from eventCh, executing insert", "event", e.Name, "block", e.BlockNumber, "txn", e.TxnHash.Hex())
+	w.inflight.Add(1)
+	go func(e *subsrciber.Event) {
+		defer w.inflight.Done()
+		// continue the trace started when the log was decoded
+		ctx := trace.ContextWithSpanContext(context.Background(), e.SpanContext)
+		ctx, span := tracer.Start(ctx, "indexer.write", trace.WithAttributes(attribute.String("table", table)))
+		defer span.End()
+
+		if e.Tx != nil {
+			// the transaction is stored first, so rows of committed events always join
+			if err := insertTransaction(ctx, w.db, e.Tx); err != nil {
+				logger.Error("failed to insert transaction", "txn", e.TxnHash.Hex(), "err", err)
+				metrics.InsertFailures.WithLabelValues("transactions").Inc()
 			}
 		}
+
+		start := time.Now()
+		id, inserted, err := executeQuery(ctx, w.db, query, args...)
+		metrics.InsertDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			metrics.InsertFailures.WithLabelValues(e.Name).Inc()
+			return
+		}
+		span.SetAttributes(attribute.Bool("inserted", inserted))
+		metrics.SetLastIndexedBlock(e.BlockNumber)
+		if !inserted {
+			return
+		}
+		for _, hook := range w.hooks {
+			hook(id, e)
+		}
+	}(e)
+}
+
+// writeCall stores tx and its decoded call in the transactions and calls tables in the
+// background, creating the tables first. Calls are found by the CallScanner rather than
+// through events, so calls emitting no event and reverted ones are stored too.
+func (w *writer) writeCall(tx *subsrciber.Transaction) {
+	if !w.tables["transactions"] {
+		if err := createTransactionsTable(context.Background(), w.db); err != nil {
+			logger.Error("failed to create transactions table", "err", err)
+		} else {
+			w.tables["transactions"] = true
+		}
+	}
+	if !w.tables["calls"] {
+		if err := createCallsTable(context.Background(), w.db); err != nil {
+			logger.Error("failed to create calls table", "err", err)
+		} else {
+			w.tables["calls"] = true
+		}
+	}
+	w.inflight.Add(1)
+	go func() {
+		defer w.inflight.Done()
+		ctx, span := tracer.Start(context.Background(), "indexer.writeCall", trace.WithAttributes(attribute.String("method", tx.Call.Method)))
+		defer span.End()
+		// the transaction is stored first, so rows of stored calls always join
+		if err := insertTransaction(ctx, w.db, tx); err != nil {
+			logger.Error("failed to insert transaction", "txn", tx.Hash.Hex(), "err", err)
+			metrics.InsertFailures.WithLabelValues("transactions").Inc()
+		}
+		if err := insertCall(ctx, w.db, tx); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			logger.Error("failed to insert call", "txn", tx.Hash.Hex(), "err", err)
+			metrics.InsertFailures.WithLabelValues("calls").Inc()
+		}
+	}()
+}
+
+// registerTable records the table of e in event_tables, creating it first, so the query APIs
+// find it by the event name.
+func (w *writer) registerTable(table string, e *subsrciber.Event) {
+	if !w.tables["event_tables"] {
+		if err := createEventTablesTable(context.Background(), w.db); err != nil {
+			logger.Error("failed to create event_tables table", "err", err)
+			return
+		}
+		w.tables["event_tables"] = true
+	}
+	if err := registerEventTable(context.Background(), w.db, table, e.Name, e.Signature); err != nil {
+		logger.Error("failed to register event table", "event", e.Name, "table", table, "err", err)
+	}
+}
+
+// writeTrace stores tr in the traces table in the background, creating the table first.
+func (w *writer) writeTrace(tr *subsrciber.Trace) {
+	if !w.tables["traces"] {
+		if err := createTracesTable(context.Background(), w.db); err != nil {
+			logger.Error("failed to create traces table", "err", err)
+		} else {
+			w.tables["traces"] = true
+		}
+	}
+	w.inflight.Add(1)
+	go func() {
+		defer w.inflight.Done()
+		ctx, span := tracer.Start(context.Background(), "indexer.writeTrace", trace.WithAttributes(attribute.String("type", tr.Type)))
+		defer span.End()
+		if err := insertTrace(ctx, w.db, tr); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			logger.Error("failed to insert trace", "txn", tr.TxnHash.Hex(), "trace", tr.Path(), "err", err)
+			metrics.InsertFailures.WithLabelValues("traces").Inc()
+		}
+	}()
+}
+
+// wait blocks until the inserts started so far are done.
+func (w *writer) wait() {
+	w.inflight.Wait()
+}
+
+// columnValue converts a decoded event value to a Postgres parameter: integers are passed as
+// decimal text for NUMERIC columns, arrays and tuples as JSON for JSONB columns.
+func columnValue(v interface{}) interface{} {
+	switch val := subsrciber.JSONValue(v).(type) {
+	case []interface{}, map[string]interface{}:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil
+		}
+		return string(data)
+	default:
+		return val
 	}
 }
 
@@ -42,14 +214,14 @@ func generateQuery(table string, param *subsrciber.Event) (string, []interface{}
 	}
 
 	// base columns
-	allCols := []string{"name", "blockNumber", "txnHash", "contract"}
+	allCols := []string{"name", "blockNumber", "txnHash", "logIndex", "contract", "decodedBy"}
 	allCols = append(allCols, fieldSlice...)
 
 	// quoted column list to avoid reserved word collisions
 	colsQuoted := make([]string, 0, len(allCols))
 	for _, c := range allCols {
 		// quote identifiers to allow reserved words like from/to as column names
-		colsQuoted = append(colsQuoted, fmt.Sprintf(`"%s"`, c))
+		colsQuoted = append(colsQuoted, quoteIdent(c))
 	}
 	colsStr := strings.Join(colsQuoted, ", ")
 
@@ -65,18 +237,15 @@ func generateQuery(table string, param *subsrciber.Event) (string, []interface{}
 	args = append(args, param.Name)
 	args = append(args, param.BlockNumber)
 	args = append(args, fmt.Sprintf("%s", param.TxnHash))
+	args = append(args, param.LogIndex)
 	args = append(args, fmt.Sprintf("%s", param.Contract))
+	args = append(args, param.DecodedBy)
 	for _, k := range fieldSlice {
-		v := param.Data[k]
-		switch val := v.(type) {
-		case *big.Int:
-			args = append(args, val.String())
-		default:
-			args = append(args, val)
-		}
+		args = append(args, columnValue(param.Data[k]))
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (\"txnHash\", \"contract\", \"from\", \"to\", \"value\") DO NOTHING", table, colsStr, phStr)
+	// no conflict target: every event table has its own unique constraint
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING RETURNING \"id\"", quoteIdent(table), colsStr, phStr)
 	return query, args
 
 }
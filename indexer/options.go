@@ -0,0 +1,188 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/subsrciber"
+)
+
+// Option configures an Indexer built by New.
+type Option func(*Indexer) error
+
+// WithConfig replaces the whole configuration, e.g. with the one read by cli.Run. Options
+// given after it override its fields.
+func WithConfig(cfg *cli.Config) Option {
+	return func(ix *Indexer) error {
+		if cfg == nil {
+			return errors.New("nil config")
+		}
+		// later options must not modify the caller's config
+		c := *cfg
+		ix.cfg = &c
+		return nil
+	}
+}
+
+// WithRPC sets the URL of the Ethereum node. Live logs need a websocket or IPC endpoint.
+func WithRPC(url string) Option {
+	return func(ix *Indexer) error {
+		ix.cfg.API.EthNodeURL = url
+		return nil
+	}
+}
+
+// WithContract sets the address of the indexed contract.
+func WithContract(address string) Option {
+	return func(ix *Indexer) error {
+		ix.cfg.Query.Address = address
+		return nil
+	}
+}
+
+// WithChainID sets the chain the contract is deployed on, used to resolve its ABI.
+func WithChainID(id int64) Option {
+	return func(ix *Indexer) error {
+		ix.cfg.API.ChainID = id
+		return nil
+	}
+}
+
+// WithEtherscanKey sets the Etherscan API key used by the etherscan ABI resolver.
+func WithEtherscanKey(key string) Option {
+	return func(ix *Indexer) error {
+		ix.cfg.API.EtherscanAPI = key
+		return nil
+	}
+}
+
+// WithABIFile reads the contract ABI from an ABI JSON file or a Hardhat/Foundry artifact
+// instead of resolving it.
+func WithABIFile(path string) Option {
+	return func(ix *Indexer) error {
+		ix.cfg.ABI.File = path
+		return nil
+	}
+}
+
+// WithABISignatures builds the contract ABI from human-readable event signatures, e.g.
+// "Transfer(address indexed from, address indexed to, uint256 value)".
+func WithABISignatures(signatures ...string) Option {
+	return func(ix *Indexer) error {
+		ix.cfg.ABI.Signatures = append(ix.cfg.ABI.Signatures, signatures...)
+		return nil
+	}
+}
+
+// WithBlockRange sets the historical block range. A to of 0 only follows new blocks once
+// the range is indexed.
+func WithBlockRange(from, to uint64) Option {
+	return func(ix *Indexer) error {
+		if to != 0 && to < from {
+			return errors.New("block range ends before it starts")
+		}
+		ix.cfg.Query.From, ix.cfg.Query.To = int(from), int(to)
+		return nil
+	}
+}
+
+// WithEvents requests events by name, overload name or signature. Events with a handler
+// registered by OnEvent are requested already.
+func WithEvents(events ...string) Option {
+	return func(ix *Indexer) error {
+		ix.addEvents(events...)
+		return nil
+	}
+}
+
+// WithFilters restricts indexed event arguments, e.g. "Transfer.to in [0xabc..., 0xdef...]".
+func WithFilters(filters ...string) Option {
+	return func(ix *Indexer) error {
+		ix.cfg.Query.Filters = append(ix.cfg.Query.Filters, filters...)
+		return nil
+	}
+}
+
+// WithTransforms adds per-event filter, derived field and rename expressions.
+func WithTransforms(transforms ...cli.EventTransform) Option {
+	return func(ix *Indexer) error {
+		ix.cfg.Events = append(ix.cfg.Events, transforms...)
+		return nil
+	}
+}
+
+// WithEnrichment adds the transaction and receipt of every event to it (Event.Tx), fetched
+// in batches of up to batchSize transactions. With a database they are stored in the
+// transactions table.
+func WithEnrichment(batchSize int) Option {
+	return func(ix *Indexer) error {
+		if batchSize <= 0 {
+			return errors.New("enrichment batch size must be positive")
+		}
+		ix.cfg.Enrich.Transactions = true
+		ix.cfg.Enrich.BatchSize = batchSize
+		return nil
+	}
+}
+
+// WithCallDecoding finds every transaction sent to the contract by scanning the blocks of
+// the indexed range, reverted ones and those emitting no event included, and decodes its
+// calldata with the contract ABI. With a database the calls are stored in the calls table.
+// Events of such transactions also get the call as Event.Tx.Call: it enables
+// WithEnrichment, with the default batch size unless set.
+func WithCallDecoding() Option {
+	return func(ix *Indexer) error {
+		ix.cfg.Enrich.Calls = true
+		return nil
+	}
+}
+
+// WithCallTracing reads the internal calls and ether transfers sent from or to the contract,
+// and the extra addresses, from execution traces with method (subsrciber.TraceDebug or
+// subsrciber.TraceFilter). Traces go to the OnTrace handlers and, with a database, to the
+// traces table. Tracing starts at the historical range start, or at the chain head without
+// one.
+func WithCallTracing(method string, addresses ...string) Option {
+	return func(ix *Indexer) error {
+		if method != subsrciber.TraceDebug && method != subsrciber.TraceFilter {
+			return fmt.Errorf("unknown trace method %q", method)
+		}
+		ix.cfg.Traces.Enabled = true
+		ix.cfg.Traces.Method = method
+		ix.cfg.Traces.Addresses = append(ix.cfg.Traces.Addresses, addresses...)
+		return nil
+	}
+}
+
+// OnTrace registers fn for every traced frame, called in block and call tree order. It
+// needs WithCallTracing. An error returned by fn stops Run.
+func OnTrace(fn func(ctx context.Context, t *subsrciber.Trace) error) Option {
+	return func(ix *Indexer) error {
+		ix.traceHandlers = append(ix.traceHandlers, fn)
+		return nil
+	}
+}
+
+// WithDB stores every event in db, one table per event. Without it events only go to the
+// handlers.
+func WithDB(db *sql.DB) Option {
+	return func(ix *Indexer) error {
+		ix.db = db
+		return nil
+	}
+}
+
+// WithBufferSize sets the number of decoded events buffered between the subscriber and the
+// handlers.
+func WithBufferSize(n int) Option {
+	return func(ix *Indexer) error {
+		if n <= 0 {
+			return errors.New("buffer size must be positive")
+		}
+		ix.buffer = n
+		return nil
+	}
+}
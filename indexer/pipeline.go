@@ -0,0 +1,279 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/metrics"
+	"github.com/naman1402/geth-indexer/subsrciber"
+)
+
+const defaultBufferSize = 1000
+
+// Indexer runs the whole pipeline for one contract: it fetches historical and live logs,
+// decodes them, calls the registered handlers and, when a database is set, stores every
+// event in Postgres. It is built with New and started with Run.
+//
+//	ix, err := indexer.New(
+//		indexer.WithRPC(rpcURL),
+//		indexer.WithContract("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"),
+//		indexer.OnEvent("Transfer", func(ctx context.Context, e *subsrciber.Event, t Transfer) error {
+//			return nil
+//		}),
+//	)
+//	if err != nil { ... }
+//	err = ix.Run(ctx)
+type Indexer struct {
+	cfg      *cli.Config
+	events   []string
+	handlers []handler
+	// traceHandlers are called for every traced frame
+	traceHandlers []func(ctx context.Context, t *subsrciber.Trace) error
+	db            *sql.DB
+	hooks         []CommitHook
+	buffer        int
+
+	contract *subsrciber.Contract
+	ctl      *subsrciber.Controller
+}
+
+// New builds an Indexer from opts, starting from cli.Defaults. It loads the contract ABI,
+// so configuration and ABI errors are returned here rather than from Run.
+func New(opts ...Option) (*Indexer, error) {
+	ix := &Indexer{cfg: cli.Defaults(), buffer: defaultBufferSize}
+	for _, opt := range opts {
+		if err := opt(ix); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case !common.IsHexAddress(ix.cfg.Query.Address):
+		return nil, fmt.Errorf("invalid contract address %q", ix.cfg.Query.Address)
+	case ix.cfg.API.EthNodeURL == "":
+		return nil, errors.New("no RPC URL set")
+	case len(ix.events) == 0:
+		return nil, errors.New("no events to index, use WithEvents or OnEvent")
+	case len(ix.traceHandlers) > 0 && !ix.cfg.Traces.Enabled:
+		return nil, errors.New("OnTrace needs WithCallTracing")
+	}
+
+	contract, err := subsrciber.NewContract(ix.cfg)
+	if err != nil {
+		return nil, err
+	}
+	ix.contract = contract
+	ix.ctl = subsrciber.NewController()
+	return ix, nil
+}
+
+// Contract returns the indexed contract and its ABI.
+func (ix *Indexer) Contract() *subsrciber.Contract {
+	return ix.contract
+}
+
+// Controller returns the controller steering the pipeline: pause, resume, backfills and
+// ABI reloads.
+func (ix *Indexer) Controller() *subsrciber.Controller {
+	return ix.ctl
+}
+
+// Events returns the requested events, from WithEvents and the registered handlers.
+func (ix *Indexer) Events() []string {
+	return append([]string(nil), ix.events...)
+}
+
+// OnCommit adds a hook called after each event is stored. Hooks need a database (WithDB)
+// and must be added before Run.
+func (ix *Indexer) OnCommit(hook CommitHook) {
+	ix.hooks = append(ix.hooks, hook)
+}
+
+// Run indexes events until ctx is done, returning nil, or until the subscriber, the
+// enrichment, the call scanner, the call tracer or a handler fails, returning its error.
+// Pending inserts are waited for before it returns.
+func (ix *Indexer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var en *subsrciber.Enricher
+	var cs *subsrciber.CallScanner
+	if ix.cfg.Enrich.Transactions || ix.cfg.Enrich.Calls {
+		client, err := rpc.DialContext(ctx, ix.cfg.API.EthNodeURL)
+		if err != nil {
+			return fmt.Errorf("failed to connect to RPC node: %w", err)
+		}
+		defer client.Close()
+		var calls *subsrciber.Contract
+		if ix.cfg.Enrich.Calls {
+			calls = ix.contract
+			cs = subsrciber.NewCallScanner(client, ix.contract, ix.cfg.Enrich.BatchSize)
+		}
+		en = subsrciber.NewEnricher(client, calls, ix.cfg.Enrich.BatchSize, ix.cfg.Enrich.CacheSize)
+	}
+
+	eventCh := make(chan *subsrciber.Event, ix.buffer)
+	metrics.RegisterQueueDepth(func() int { return len(eventCh) })
+
+	var w *writer
+	if ix.db != nil {
+		w = newWriter(ix.db)
+		w.hooks = ix.hooks
+		defer w.wait()
+	}
+
+	// traceCh stays nil, never ready, without tracing
+	var traceCh chan *subsrciber.Trace
+	var traceErr chan error
+	if ix.cfg.Traces.Enabled {
+		client, err := subsrciber.DialTracer(ctx, ix.cfg)
+		if err != nil {
+			return fmt.Errorf("failed to connect tracer: %w", err)
+		}
+		defer client.Close()
+		ct, err := subsrciber.NewCallTracer(client, ix.contract, ix.cfg)
+		if err != nil {
+			return err
+		}
+		traceCh = make(chan *subsrciber.Trace, ix.buffer)
+		traceErr = make(chan error, 1)
+		go func() {
+			traceErr <- ct.Run(ctx, uint64(ix.cfg.Query.From), uint64(ix.cfg.Query.To), traceCh)
+		}()
+	}
+
+	// callCh stays nil, never ready, without call decoding
+	var callCh chan *subsrciber.Transaction
+	var callErr chan error
+	if cs != nil {
+		callCh = make(chan *subsrciber.Transaction, ix.buffer)
+		callErr = make(chan error, 1)
+		go func() {
+			callErr <- cs.Run(ctx, uint64(ix.cfg.Query.From), uint64(ix.cfg.Query.To), callCh)
+		}()
+	}
+
+	subErr := make(chan error, 1)
+	go func() {
+		subErr <- subsrciber.Subscribe(ctx, ix.events, eventCh, ix.cfg, ix.contract, ix.ctl)
+	}()
+
+	// stop cancels the subscriber, the call scanner and the tracer and returns err once they
+	// are done
+	stop := func(err error) error {
+		cancel()
+		<-subErr
+		if callErr != nil {
+			<-callErr
+		}
+		if traceErr != nil {
+			<-traceErr
+		}
+		return err
+	}
+	for {
+		select {
+		case err := <-subErr:
+			cancel()
+			if callErr != nil {
+				<-callErr
+			}
+			if traceErr != nil {
+				<-traceErr
+			}
+			return err
+		case err := <-callErr:
+			// the scanner is done once its block range is scanned
+			callErr = nil
+			if err != nil {
+				return stop(err)
+			}
+		case tx := <-callCh:
+			if w != nil {
+				w.writeCall(tx)
+			}
+		case err := <-traceErr:
+			// the tracer is done once its block range is traced
+			traceErr = nil
+			if err != nil {
+				return stop(err)
+			}
+		case tr := <-traceCh:
+			for _, fn := range ix.traceHandlers {
+				if err := fn(ctx, tr); err != nil {
+					return stop(fmt.Errorf("trace handler failed at block %d, txn %s: %w", tr.BlockNumber, tr.TxnHash.Hex(), err))
+				}
+			}
+			if w != nil {
+				w.writeTrace(tr)
+			}
+		case e := <-eventCh:
+			batch := []*subsrciber.Event{e}
+			if en != nil {
+				// events already buffered are enriched together, in batched calls
+				batch = drain(batch, eventCh, ix.cfg.Enrich.BatchSize)
+				if err := en.Enrich(ctx, batch); err != nil {
+					if ctx.Err() != nil {
+						return stop(nil)
+					}
+					return stop(err)
+				}
+			}
+			for _, e := range batch {
+				if err := ix.dispatch(ctx, e); err != nil {
+					return stop(err)
+				}
+				if w != nil {
+					w.write(e)
+				}
+			}
+		}
+	}
+}
+
+// drain appends the events waiting in eventCh to batch, up to size events.
+func drain(batch []*subsrciber.Event, eventCh <-chan *subsrciber.Event, size int) []*subsrciber.Event {
+	for len(batch) < size {
+		select {
+		case e := <-eventCh:
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// dispatch calls the handlers registered for e, in registration order.
+func (ix *Indexer) dispatch(ctx context.Context, e *subsrciber.Event) error {
+	for _, h := range ix.handlers {
+		if !e.Matches(h.event) {
+			continue
+		}
+		if err := h.fn(ctx, e); err != nil {
+			return fmt.Errorf("%s handler failed at block %d, txn %s: %w", h.event, e.BlockNumber, e.TxnHash.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// addEvents requests events, skipping the ones already requested.
+func (ix *Indexer) addEvents(events ...string) {
+	for _, event := range events {
+		found := false
+		for _, e := range ix.events {
+			if e == event {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ix.events = append(ix.events, event)
+		}
+	}
+}
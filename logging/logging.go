@@ -0,0 +1,131 @@
+// Package logging provides leveled, structured logging (log/slog) for the indexer
+// components, with per-component levels and redaction of credentials.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Config holds the logging configuration.
+type Config struct {
+	// Format is "text" (default) or "json".
+	Format string
+	// Level is the default level: debug, info, warn or error.
+	Level string
+	// Components overrides the level per component, e.g. {"subscriber": "debug"}.
+	Components map[string]string
+}
+
+var (
+	mu         sync.RWMutex
+	base       slog.Handler = newBaseHandler(os.Stderr, "text")
+	level                   = slog.LevelInfo
+	components              = map[string]slog.Level{}
+)
+
+// Setup installs the configuration for all component loggers and the slog default logger.
+// Loggers returned by For before Setup pick up the new configuration.
+func Setup(cfg Config) {
+	mu.Lock()
+	base = newBaseHandler(os.Stderr, cfg.Format)
+	level = parseLevel(cfg.Level, slog.LevelInfo)
+	components = make(map[string]slog.Level, len(cfg.Components))
+	for name, l := range cfg.Components {
+		components[name] = parseLevel(l, level)
+	}
+	mu.Unlock()
+
+	slog.SetDefault(For("main"))
+}
+
+// For returns the logger of a component. Its records carry a "component" attribute and
+// are filtered by the component's level.
+func For(component string) *slog.Logger {
+	h := &handler{component: component}
+	return slog.New(h.WithAttrs([]slog.Attr{slog.String("component", component)}))
+}
+
+// ParseLevels parses per-component levels written as "subscriber=debug,indexer=warn".
+func ParseLevels(s string) map[string]string {
+	levels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		name, l, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && name != "" {
+			levels[name] = l
+		}
+	}
+	return levels
+}
+
+func newBaseHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
+		// every component filters by its own level in handler.Enabled
+		Level:       slog.LevelDebug,
+		ReplaceAttr: redactAttr,
+	}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+func parseLevel(s string, fallback slog.Level) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return fallback
+	}
+	return l
+}
+
+// handler resolves the base handler and component level at log time, so package-level
+// loggers created before Setup follow the configuration.
+type handler struct {
+	component string
+	// ops replays WithAttrs/WithGroup calls on the current base handler
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	min, ok := components[h.component]
+	if !ok {
+		min = level
+	}
+	return l >= min
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	mu.RLock()
+	next := base
+	mu.RUnlock()
+	for _, op := range h.ops {
+		next = op(next)
+	}
+	return next.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) *handler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &handler{component: h.component, ops: append(ops, op)}
+}
+
+// Fatal logs msg at error level and exits the process, replacing log.Fatal.
+func Fatal(l *slog.Logger, msg string, args ...any) {
+	l.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces credentials in log output.
+const Redacted = "REDACTED"
+
+var (
+	// sensitiveKeys are attribute and query parameter names whose values are always redacted.
+	sensitiveKeys = []string{"apikey", "api_key", "key", "token", "secret", "password", "passwd"}
+	// urlPattern finds URLs embedded in log messages and values.
+	urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+	// keySegment matches path segments that look like API keys, e.g. Infura /v3/<key>.
+	keySegment = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+)
+
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, k := range sensitiveKeys {
+		if name == k || strings.HasSuffix(name, "_"+k) {
+			return true
+		}
+	}
+	// compound names without a separator, e.g. dbpassword or etherscanapikey
+	return strings.HasSuffix(name, "password") || strings.HasSuffix(name, "apikey") || strings.HasSuffix(name, "secret")
+}
+
+// RedactURL masks credentials in a URL: userinfo passwords, sensitive query parameters
+// and path segments that look like API keys.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for name := range q {
+			if isSensitive(name) {
+				q.Set(name, Redacted)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, s := range segments {
+		if keySegment.MatchString(s) && !strings.HasPrefix(s, "0x") {
+			segments[i] = Redacted
+		}
+	}
+	u.Path = strings.Join(segments, "/")
+	u.RawPath = ""
+	return u.String()
+}
+
+// Redact masks credentials in every URL found in s.
+func Redact(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	return urlPattern.ReplaceAllStringFunc(s, RedactURL)
+}
+
+// redactAttr is the slog ReplaceAttr hook: it hides values of sensitive attributes and
+// credentials in URLs, including inside error messages.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if isSensitive(a.Key) {
+		if a.Value.Kind() == slog.KindString && a.Value.String() == "" {
+			return a
+		}
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
@@ -1,17 +1,21 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
-	"sync"
+	"path/filepath"
 	"syscall"
 
+	"github.com/naman1402/geth-indexer/api"
 	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/codegen"
 	"github.com/naman1402/geth-indexer/indexer"
+	"github.com/naman1402/geth-indexer/logging"
 	"github.com/naman1402/geth-indexer/subsrciber"
+	"github.com/naman1402/geth-indexer/tracing"
 )
 
 const channelBufferSize = 1000
@@ -22,66 +26,176 @@ func main() {
 }
 
 func exec() int {
-	var wg sync.WaitGroup
-	defer wg.Done()
-	wg.Add(2)
-
 	// Returns Config (Query, Database, API) ✅
 	options := cli.Run()
-	fmt.Printf("Loaded configuration\nRPC Node URL (WS): %+v\nEtherscan API Key: %+v\n", options.API.EthNodeURL, options.API.EtherscanAPI)
-	fmt.Printf("Database configuration: Host=%s, Port=%d, User=%s, DBName=%s\n", options.Database.DBHost, options.Database.DBPort, options.Database.DBUser, options.Database.DBName)
-	fmt.Printf("Query configuration: Address=%s, From=%d, To=%d\n", options.Query.Address, options.Query.From, options.Query.To)
+	logging.Setup(options.Log)
+	// Config implements slog.LogValuer, credentials are redacted
+	slog.Info("loaded configuration", "config", options)
+
+	// Export spans over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing, err := tracing.Setup(context.Background(), options.Tracing)
+	if err != nil {
+		slog.Error("failed to set up tracing", "err", err)
+		return 1
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("failed to flush spans", "err", err)
+		}
+	}()
 
 	// Reading non-flags arguments
 	flag.Parse() // go run test.go Transfer
 	events := flag.Args()
 	if len(events) == 0 {
-		log.Println("no events provided, please specify smart contract events")
+		slog.Error("no events provided, please specify smart contract events")
 		return 1
 	}
+	// go run main.go abi refresh|pin [file]|unpin
+	if events[0] == "abi" {
+		return abiCommand(options, events[1:])
+	}
+	// go run main.go generate [-out dir] [-package name] [-migrations dir] [events...]
+	if events[0] == "generate" {
+		return generateCommand(options, events[1:])
+	}
 
-	// Create a channel to receive events from the subscriber
-	eventChannel := make(chan *subsrciber.Event, channelBufferSize)
-	// Create quitChannel to know when to terminate the program
-	quitChannel := make(chan bool)
-
-	go stopSignal(quitChannel)
-	go subsrciber.Subscribe(events, eventChannel, options, quitChannel)
+	// Stop on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Connect to Postgres database using provided configuration options ✅
 	db, err := indexer.Connect(options.Database)
 	if err != nil {
-		log.Println(err)
+		slog.Error("failed to connect to database", "err", err)
 		return 1
 	}
 
 	// Ensure database connection is closed when the function exits ✅
-	defer func() int {
+	defer func() {
 		if err := db.Close(); err != nil {
-			log.Println(err)
-			return 1
+			slog.Error("failed to close database", "err", err)
 		}
-		return 0
 	}()
 
-	// Indexes events from the eventChannel and stores them in the database
-	go indexer.Index(eventChannel, db, quitChannel)
+	// The CLI is a thin wrapper around the indexer package, which fetches the contract ABI
+	// up front: it is shared by the subscriber and the GraphQL API
+	ix, err := indexer.New(
+		indexer.WithConfig(options),
+		indexer.WithEvents(events...),
+		indexer.WithDB(db),
+		indexer.WithBufferSize(channelBufferSize),
+	)
+	if err != nil {
+		slog.Error("failed to set up indexer", "err", err)
+		return 1
+	}
+
+	// The controller is used by the gRPC admin RPCs to steer the subscriber
+	server := api.NewServer(options.Server, db, ix.Contract(), ix.Controller())
+	// committed events are streamed to the API clients
+	ix.OnCommit(server.Publish)
 
-	// Wait for all goroutines to finish and then return 0 s
-	wg.Wait()
+	// Serve the indexed events over HTTP and gRPC
+	go func() {
+		if err := server.ListenAndServe(options.Server.Addr); err != nil {
+			slog.Error("HTTP server stopped", "err", err)
+		}
+	}()
+	go func() {
+		if err := server.ListenAndServeGRPC(options.Server.GRPCAddr); err != nil {
+			slog.Error("gRPC server stopped", "err", err)
+		}
+	}()
+
+	// Index until a signal arrives or the pipeline fails
+	if err := ix.Run(ctx); err != nil {
+		slog.Error("indexer stopped", "err", err)
+		return 1
+	}
+	slog.Info("indexer stopped")
 	return 0
 }
 
-// stopSignal listens for user input on the console and sends a signal to the quitChannel
-// when the user types "stop". This allows the main program to gracefully exit.
-func stopSignal(quitChannel chan bool) {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+// abiCommand manages the cached ABI of the configured contract and prints the resulting
+// cache entry.
+func abiCommand(options *cli.Config, args []string) int {
+	if len(args) == 0 {
+		slog.Error("usage: abi refresh | abi pin [file] | abi unpin")
+		return 1
+	}
+
+	var (
+		entry *subsrciber.CachedABI
+		err   error
+	)
+	ctx := context.Background()
+	switch args[0] {
+	case "refresh":
+		entry, err = subsrciber.RefreshABI(ctx, options)
+	case "pin":
+		file := ""
+		if len(args) > 1 {
+			file = args[1]
+		}
+		entry, err = subsrciber.PinABI(ctx, options, file)
+	case "unpin":
+		entry, err = subsrciber.UnpinABI(options)
+	default:
+		slog.Error("unknown abi command", "command", args[0])
+		return 1
+	}
+	if err != nil {
+		slog.Error("abi command failed", "command", args[0], "err", err)
+		return 1
+	}
+
+	slog.Info("cached ABI",
+		"contract", entry.Address.Hex(),
+		"chain_id", entry.ChainID,
+		"source", entry.Source,
+		"implementation", entry.Implementation.Hex(),
+		"fetched_at", entry.FetchedAt,
+		"pinned", entry.Pinned)
+	return 0
+}
 
-	// Wait for either OS signal or manual stop
-	select {
-	case <-sigChan:
-		quitChannel <- true
+// generateCommand writes typed Go bindings and SQL migrations for the events of the configured
+// contract, every ABI event when none are given.
+func generateCommand(options *cli.Config, args []string) int {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	out := flags.String("out", "bindings", "directory of the generated Go package")
+	pkg := flags.String("package", "", "name of the generated Go package (default: base name of -out)")
+	migrations := flags.String("migrations", "migrations", "directory of the generated SQL migrations, empty to skip them")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if *pkg == "" {
+		*pkg = filepath.Base(*out)
 	}
 
+	parsed, err := subsrciber.LoadABI(options)
+	if err != nil {
+		slog.Error("failed to load contract ABI", "err", err)
+		return 1
+	}
+	source := options.Query.Address
+	if options.ABI.File != "" {
+		source = options.ABI.File
+	}
+	files, err := codegen.Generate(parsed, codegen.Options{
+		Package:       *pkg,
+		Dir:           *out,
+		MigrationsDir: *migrations,
+		Events:        flags.Args(),
+		Source:        source,
+	})
+	for _, file := range files {
+		slog.Info("generated", "file", file)
+	}
+	if err != nil {
+		slog.Error("generate failed", "err", err)
+		return 1
+	}
+	return 0
 }
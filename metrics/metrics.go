@@ -0,0 +1,163 @@
+// Package metrics defines the Prometheus metrics exported by the indexer pipeline.
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const namespace = "geth_indexer"
+
+var (
+	// LogsReceived counts raw logs received from the node, by source (historical, live, backfill).
+	LogsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logs_received_total",
+		Help:      "Logs received from the Ethereum node.",
+	}, []string{"source"})
+
+	// EventsDecoded counts logs decoded into events, by event name.
+	EventsDecoded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_decoded_total",
+		Help:      "Logs successfully decoded into events.",
+	}, []string{"event"})
+
+	// EventsDropped counts logs that did not reach the event channel, by event name and reason.
+	EventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dropped_total",
+		Help:      "Logs dropped before indexing.",
+	}, []string{"event", "reason"})
+
+	// InsertDuration observes the latency of event inserts.
+	InsertDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "insert_duration_seconds",
+		Help:      "Latency of event inserts into Postgres.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// InsertFailures counts failed event inserts, by event name.
+	InsertFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "insert_failures_total",
+		Help:      "Event inserts that failed.",
+	}, []string{"event"})
+
+	// LastIndexedBlock is the highest block number of a committed event.
+	LastIndexedBlock = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_indexed_block",
+		Help:      "Highest block number of an event committed to Postgres.",
+	})
+
+	// ChainHead is the latest block number reported by the node.
+	ChainHead = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "chain_head_block",
+		Help:      "Latest block number reported by the Ethereum node.",
+	})
+
+	// RPCRequests counts JSON-RPC calls to the node, by method.
+	RPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "JSON-RPC calls made to the Ethereum node.",
+	}, []string{"method"})
+
+	// RPCErrors counts failed JSON-RPC calls to the node, by method.
+	RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "JSON-RPC calls to the Ethereum node that failed.",
+	}, []string{"method"})
+
+	// TracesReceived counts internal calls read from execution traces, by frame type.
+	TracesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "traces_received_total",
+		Help:      "Frames of execution traces touching the traced addresses.",
+	}, []string{"type"})
+
+	// EtherscanRequests counts Etherscan API calls, by action and outcome.
+	EtherscanRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "etherscan_requests_total",
+		Help:      "Etherscan API requests by action and outcome.",
+	}, []string{"action", "outcome"})
+)
+
+var lastBlockMu sync.Mutex
+
+var (
+	queueDepthOnce sync.Once
+	queueDepth     atomic.Pointer[func() int]
+)
+
+func init() {
+	// lag is computed at scrape time so it always reflects the latest gauges
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "indexing_lag_blocks",
+		Help:      "Chain head minus the last indexed block.",
+	}, Lag)
+}
+
+// Lag returns the number of blocks between the chain head and the last indexed block.
+func Lag() float64 {
+	head := readGauge(ChainHead)
+	last := readGauge(LastIndexedBlock)
+	if head == 0 || last == 0 || last > head {
+		return 0
+	}
+	return head - last
+}
+
+// ObserveRPC records a JSON-RPC call to the node and its outcome.
+func ObserveRPC(method string, err error) {
+	RPCRequests.WithLabelValues(method).Inc()
+	if err != nil {
+		RPCErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// SetLastIndexedBlock raises LastIndexedBlock to block, it never moves backwards
+// since historical and live events are committed out of order.
+func SetLastIndexedBlock(block uint64) {
+	lastBlockMu.Lock()
+	defer lastBlockMu.Unlock()
+	if float64(block) > readGauge(LastIndexedBlock) {
+		LastIndexedBlock.Set(float64(block))
+	}
+}
+
+// RegisterQueueDepth exports the length of the event channel as a gauge. Calling it again
+// replaces the reported function, e.g. when an embedded indexer is restarted.
+func RegisterQueueDepth(depth func() int) {
+	queueDepth.Store(&depth)
+	queueDepthOnce.Do(func() {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "event_queue_depth",
+			Help:      "Events waiting in the channel between the subscriber and the indexer.",
+		}, func() float64 {
+			if d := queueDepth.Load(); d != nil {
+				return float64((*d)())
+			}
+			return 0
+		})
+	})
+}
+
+func readGauge(g prometheus.Gauge) float64 {
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetGauge().GetValue()
+}
@@ -0,0 +1,3 @@
+-- Record whether an event was decoded with the contract ABI ('abi') or by matching a
+-- standard event signature ('signature')
+ALTER TABLE transfer ADD COLUMN IF NOT EXISTS "decodedBy" VARCHAR(16) NOT NULL DEFAULT 'abi';
@@ -0,0 +1,3 @@
+-- Record the position of the log in its block. Tables created by the indexer for other
+-- events are unique on ("txnHash", "logIndex"); rows inserted before this migration keep NULL
+ALTER TABLE transfer ADD COLUMN IF NOT EXISTS "logIndex" INTEGER;
@@ -0,0 +1,18 @@
+-- Create the transactions table filled when ENRICH_TRANSACTIONS=true. It is shared by every
+-- event table and joined on "txnHash" = "hash"
+CREATE TABLE IF NOT EXISTS transactions (
+    "hash" VARCHAR(66) PRIMARY KEY,
+    "blockNumber" BIGINT NOT NULL,
+    "from" VARCHAR(42) NOT NULL,
+    "to" VARCHAR(42),
+    "nonce" BIGINT NOT NULL,
+    "gasPrice" NUMERIC,
+    "maxFeePerGas" NUMERIC,
+    "effectiveGasPrice" NUMERIC,
+    "gasUsed" BIGINT NOT NULL,
+    "status" SMALLINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_from ON transactions("from");
+CREATE INDEX IF NOT EXISTS idx_transactions_block ON transactions("blockNumber");
@@ -0,0 +1,18 @@
+-- Create the calls table filled when DECODE_CALLS=true: the decoded calldata of every
+-- transaction sent to the contract, reverted or not, joined with the event tables on "txnHash"
+CREATE TABLE IF NOT EXISTS calls (
+    "txnHash" VARCHAR(66) PRIMARY KEY,
+    "blockNumber" BIGINT NOT NULL,
+    "contract" VARCHAR(42) NOT NULL,
+    "from" VARCHAR(42) NOT NULL,
+    "method" VARCHAR(100),
+    "signature" TEXT,
+    "selector" VARCHAR(10),
+    "args" JSONB,
+    "value" NUMERIC NOT NULL,
+    "success" BOOLEAN NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_calls_method ON calls("method");
+CREATE INDEX IF NOT EXISTS idx_calls_block ON calls("blockNumber");
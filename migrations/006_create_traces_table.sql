@@ -0,0 +1,24 @@
+-- Create the traces table filled when TRACE_CALLS=true: the internal calls, creations and
+-- self-destructs sent from or to the traced addresses, one row per frame of a call tree
+CREATE TABLE IF NOT EXISTS traces (
+    id SERIAL PRIMARY KEY,
+    "blockNumber" BIGINT NOT NULL,
+    "txnHash" VARCHAR(66) NOT NULL,
+    "traceAddress" TEXT NOT NULL,
+    "type" VARCHAR(16) NOT NULL,
+    "from" VARCHAR(42) NOT NULL,
+    "to" VARCHAR(42) NOT NULL,
+    "value" NUMERIC NOT NULL,
+    "gas" BIGINT NOT NULL,
+    "gasUsed" BIGINT NOT NULL,
+    "input" TEXT,
+    "method" VARCHAR(100),
+    "args" JSONB,
+    "error" TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE ("txnHash", "traceAddress")
+);
+
+CREATE INDEX IF NOT EXISTS idx_traces_block ON traces("blockNumber");
+CREATE INDEX IF NOT EXISTS idx_traces_from ON traces("from");
+CREATE INDEX IF NOT EXISTS idx_traces_to ON traces("to");
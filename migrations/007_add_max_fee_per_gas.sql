@@ -0,0 +1,3 @@
+-- Record the fee cap of EIP-1559 transactions apart from "gasPrice", which holds the gas
+-- price returned by the node. Legacy transactions and rows inserted before this migration keep NULL
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS "maxFeePerGas" NUMERIC;
@@ -0,0 +1,11 @@
+-- Create the event_tables table, filled by the indexer with the table of every event it writes.
+-- The query APIs resolve event names through it, reaching tables of their own such as transfer_1f2e3d4c
+CREATE TABLE IF NOT EXISTS event_tables (
+    "table" VARCHAR(63) NOT NULL,
+    "event" VARCHAR(100) NOT NULL,
+    "signature" TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY ("table", "signature")
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_tables_event ON event_tables("event");
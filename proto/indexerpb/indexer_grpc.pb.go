@@ -0,0 +1,384 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: indexer.proto
+
+package indexerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Indexer_ListEvents_FullMethodName      = "/indexer.v1.Indexer/ListEvents"
+	Indexer_GetCheckpoint_FullMethodName   = "/indexer.v1.Indexer/GetCheckpoint"
+	Indexer_SubscribeEvents_FullMethodName = "/indexer.v1.Indexer/SubscribeEvents"
+	Indexer_StartBackfill_FullMethodName   = "/indexer.v1.Indexer/StartBackfill"
+	Indexer_PauseIngestion_FullMethodName  = "/indexer.v1.Indexer/PauseIngestion"
+	Indexer_ResumeIngestion_FullMethodName = "/indexer.v1.Indexer/ResumeIngestion"
+	Indexer_ReloadABI_FullMethodName       = "/indexer.v1.Indexer/ReloadABI"
+)
+
+// IndexerClient is the client API for Indexer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Indexer exposes the indexed events and control over the running indexer.
+type IndexerClient interface {
+	// ListEvents returns one page of indexed events of a single event type.
+	ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error)
+	// GetCheckpoint reports how far the indexer has progressed.
+	GetCheckpoint(ctx context.Context, in *GetCheckpointRequest, opts ...grpc.CallOption) (*Checkpoint, error)
+	// SubscribeEvents streams events as they are committed to the database.
+	SubscribeEvents(ctx context.Context, in *SubscribeEventsRequest, opts ...grpc.CallOption) (Indexer_SubscribeEventsClient, error)
+	// StartBackfill re-fetches historical logs for a block range.
+	StartBackfill(ctx context.Context, in *StartBackfillRequest, opts ...grpc.CallOption) (*StartBackfillResponse, error)
+	// PauseIngestion stops forwarding logs to the indexer until resumed.
+	PauseIngestion(ctx context.Context, in *PauseIngestionRequest, opts ...grpc.CallOption) (*IngestionStatus, error)
+	// ResumeIngestion resumes ingestion and backfills the blocks skipped while paused.
+	ResumeIngestion(ctx context.Context, in *ResumeIngestionRequest, opts ...grpc.CallOption) (*IngestionStatus, error)
+	// ReloadABI fetches the contract ABI again and swaps it into the decoder.
+	ReloadABI(ctx context.Context, in *ReloadABIRequest, opts ...grpc.CallOption) (*ReloadABIResponse, error)
+}
+
+type indexerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIndexerClient(cc grpc.ClientConnInterface) IndexerClient {
+	return &indexerClient{cc}
+}
+
+func (c *indexerClient) ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListEventsResponse)
+	err := c.cc.Invoke(ctx, Indexer_ListEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetCheckpoint(ctx context.Context, in *GetCheckpointRequest, opts ...grpc.CallOption) (*Checkpoint, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Checkpoint)
+	err := c.cc.Invoke(ctx, Indexer_GetCheckpoint_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) SubscribeEvents(ctx context.Context, in *SubscribeEventsRequest, opts ...grpc.CallOption) (Indexer_SubscribeEventsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Indexer_ServiceDesc.Streams[0], Indexer_SubscribeEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &indexerSubscribeEventsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Indexer_SubscribeEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type indexerSubscribeEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *indexerSubscribeEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *indexerClient) StartBackfill(ctx context.Context, in *StartBackfillRequest, opts ...grpc.CallOption) (*StartBackfillResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StartBackfillResponse)
+	err := c.cc.Invoke(ctx, Indexer_StartBackfill_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) PauseIngestion(ctx context.Context, in *PauseIngestionRequest, opts ...grpc.CallOption) (*IngestionStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IngestionStatus)
+	err := c.cc.Invoke(ctx, Indexer_PauseIngestion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) ResumeIngestion(ctx context.Context, in *ResumeIngestionRequest, opts ...grpc.CallOption) (*IngestionStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IngestionStatus)
+	err := c.cc.Invoke(ctx, Indexer_ResumeIngestion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) ReloadABI(ctx context.Context, in *ReloadABIRequest, opts ...grpc.CallOption) (*ReloadABIResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReloadABIResponse)
+	err := c.cc.Invoke(ctx, Indexer_ReloadABI_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// IndexerServer is the server API for Indexer service.
+// All implementations must embed UnimplementedIndexerServer
+// for forward compatibility
+//
+// Indexer exposes the indexed events and control over the running indexer.
+type IndexerServer interface {
+	// ListEvents returns one page of indexed events of a single event type.
+	ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error)
+	// GetCheckpoint reports how far the indexer has progressed.
+	GetCheckpoint(context.Context, *GetCheckpointRequest) (*Checkpoint, error)
+	// SubscribeEvents streams events as they are committed to the database.
+	SubscribeEvents(*SubscribeEventsRequest, Indexer_SubscribeEventsServer) error
+	// StartBackfill re-fetches historical logs for a block range.
+	StartBackfill(context.Context, *StartBackfillRequest) (*StartBackfillResponse, error)
+	// PauseIngestion stops forwarding logs to the indexer until resumed.
+	PauseIngestion(context.Context, *PauseIngestionRequest) (*IngestionStatus, error)
+	// ResumeIngestion resumes ingestion and backfills the blocks skipped while paused.
+	ResumeIngestion(context.Context, *ResumeIngestionRequest) (*IngestionStatus, error)
+	// ReloadABI fetches the contract ABI again and swaps it into the decoder.
+	ReloadABI(context.Context, *ReloadABIRequest) (*ReloadABIResponse, error)
+	mustEmbedUnimplementedIndexerServer()
+}
+
+// UnimplementedIndexerServer must be embedded to have forward compatible implementations.
+type UnimplementedIndexerServer struct {
+}
+
+func (UnimplementedIndexerServer) ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListEvents not implemented")
+}
+func (UnimplementedIndexerServer) GetCheckpoint(context.Context, *GetCheckpointRequest) (*Checkpoint, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCheckpoint not implemented")
+}
+func (UnimplementedIndexerServer) SubscribeEvents(*SubscribeEventsRequest, Indexer_SubscribeEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeEvents not implemented")
+}
+func (UnimplementedIndexerServer) StartBackfill(context.Context, *StartBackfillRequest) (*StartBackfillResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartBackfill not implemented")
+}
+func (UnimplementedIndexerServer) PauseIngestion(context.Context, *PauseIngestionRequest) (*IngestionStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseIngestion not implemented")
+}
+func (UnimplementedIndexerServer) ResumeIngestion(context.Context, *ResumeIngestionRequest) (*IngestionStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeIngestion not implemented")
+}
+func (UnimplementedIndexerServer) ReloadABI(context.Context, *ReloadABIRequest) (*ReloadABIResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadABI not implemented")
+}
+func (UnimplementedIndexerServer) mustEmbedUnimplementedIndexerServer() {}
+
+// UnsafeIndexerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IndexerServer will
+// result in compilation errors.
+type UnsafeIndexerServer interface {
+	mustEmbedUnimplementedIndexerServer()
+}
+
+func RegisterIndexerServer(s grpc.ServiceRegistrar, srv IndexerServer) {
+	s.RegisterService(&Indexer_ServiceDesc, srv)
+}
+
+func _Indexer_ListEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).ListEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_ListEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).ListEvents(ctx, req.(*ListEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetCheckpoint_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCheckpointRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetCheckpoint(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetCheckpoint_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetCheckpoint(ctx, req.(*GetCheckpointRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_SubscribeEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IndexerServer).SubscribeEvents(m, &indexerSubscribeEventsServer{ServerStream: stream})
+}
+
+type Indexer_SubscribeEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type indexerSubscribeEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *indexerSubscribeEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Indexer_StartBackfill_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartBackfillRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).StartBackfill(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_StartBackfill_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).StartBackfill(ctx, req.(*StartBackfillRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_PauseIngestion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseIngestionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).PauseIngestion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_PauseIngestion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).PauseIngestion(ctx, req.(*PauseIngestionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_ResumeIngestion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeIngestionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).ResumeIngestion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_ResumeIngestion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).ResumeIngestion(ctx, req.(*ResumeIngestionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_ReloadABI_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadABIRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).ReloadABI(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_ReloadABI_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).ReloadABI(ctx, req.(*ReloadABIRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Indexer_ServiceDesc is the grpc.ServiceDesc for Indexer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Indexer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "indexer.v1.Indexer",
+	HandlerType: (*IndexerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListEvents",
+			Handler:    _Indexer_ListEvents_Handler,
+		},
+		{
+			MethodName: "GetCheckpoint",
+			Handler:    _Indexer_GetCheckpoint_Handler,
+		},
+		{
+			MethodName: "StartBackfill",
+			Handler:    _Indexer_StartBackfill_Handler,
+		},
+		{
+			MethodName: "PauseIngestion",
+			Handler:    _Indexer_PauseIngestion_Handler,
+		},
+		{
+			MethodName: "ResumeIngestion",
+			Handler:    _Indexer_ResumeIngestion_Handler,
+		},
+		{
+			MethodName: "ReloadABI",
+			Handler:    _Indexer_ReloadABI_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeEvents",
+			Handler:       _Indexer_SubscribeEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "indexer.proto",
+}
@@ -1,132 +1,291 @@
 package subsrciber
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const etherscanURLTemplate = "https://api.etherscan.io/api?module=contract&action=getabi&address=%s&apikey=%s"
+// Errors reported by Etherscan in a status "0" response, wrapped in an *EtherscanError.
+var (
+	ErrRateLimited         = errors.New("etherscan rate limit reached")
+	ErrInvalidAPIKey       = errors.New("invalid etherscan API key")
+	ErrUnsupportedChain    = errors.New("chain not supported by etherscan")
+	ErrContractNotVerified = fmt.Errorf("contract source code not verified: %w", ErrABINotFound)
+)
 
-// fetchABI fetches the ABI (Application Binary Interface) from the Etherscan API
-// using the provided etherscanAPI string. It returns the parsed ABI. ✅
-func fetchABI(opts *cli.Config) abi.ABI {
-	etherscanAPI := opts.API.EtherscanAPI
-	if etherscanAPI == "" {
-		log.Fatal("ETHERSCAN_API_KEY environment variable is not set")
-	}
+// EtherscanError is returned when Etherscan answers with status "0".
+type EtherscanError struct {
+	// Action is the API action that failed, e.g. "getabi".
+	Action  string
+	Message string
+	Result  string
+	// Kind is one of the Err* values above, or nil when the error is not classified.
+	Kind error
+}
 
-	contractAddr := opts.Query.Address
-	if contractAddr == "" {
-		log.Fatal("CONTRACT_ADDRESS environment variable is not set")
+func (e *EtherscanError) Error() string {
+	return fmt.Sprintf("etherscan %s: %s: %s", e.Action, e.Message, e.Result)
+}
+
+func (e *EtherscanError) Unwrap() error { return e.Kind }
+
+// newEtherscanError classifies a status "0" response by its result text.
+func newEtherscanError(action, message, result string) *EtherscanError {
+	e := &EtherscanError{Action: action, Message: message, Result: result}
+	lower := strings.ToLower(result)
+	switch {
+	case strings.Contains(lower, "rate limit"):
+		e.Kind = ErrRateLimited
+	case strings.Contains(lower, "api key"):
+		e.Kind = ErrInvalidAPIKey
+	case strings.Contains(lower, "chainid"):
+		e.Kind = ErrUnsupportedChain
+	case strings.Contains(lower, "not verified"):
+		e.Kind = ErrContractNotVerified
 	}
+	return e
+}
 
-	proxyResult, ActualImplementationAddress, _ := getProxyInfoAndImplementation(contractAddr, etherscanAPI)
+// fetchABI resolves the contract ABI through the configured resolver chain
+// (Etherscan, Sourcify, Blockscout), served from the ABI cache unless refresh is set.
+// It returns the parsed ABI and, for a proxy, its current implementation. ✅
+func fetchABI(opts *cli.Config, refresh bool) (abi.ABI, common.Address, error) {
+	ctx, span := tracer.Start(context.Background(), "subscriber.resolveABI",
+		trace.WithAttributes(
+			attribute.String("contract", opts.Query.Address),
+			attribute.Bool("refresh", refresh)))
+	defer span.End()
 
-	if proxyResult {
-		fmt.Printf("Address: %s is a proxy contract, using implementation address: %s to get the ABI\n ", contractAddr, ActualImplementationAddress)
-		contractAddr = ActualImplementationAddress
-	} else {
-		fmt.Printf("Address: %s is not a proxy contract, using it to get the ABI\n", contractAddr)
+	res, err := resolveABI(ctx, opts, refresh)
+	if err != nil {
+		recordSpanError(span, err)
+		return abi.ABI{}, common.Address{}, err
 	}
 
-	url := fmt.Sprintf(etherscanURLTemplate, contractAddr, etherscanAPI)
-	fmt.Printf("Calling etherscan for ABI, URL: %s\n", url)
-	resp, err := http.Get(url)
+	proxy := res.Implementation != common.Address{}
+	var proxyABI *abi.ABI
+	if proxy {
+		own := resolveProxyABI(ctx, opts, common.HexToAddress(opts.Query.Address), refresh)
+		proxyABI = &own
+	}
+	parsed, err := decoderABI(opts, res.ABI, proxyABI)
 	if err != nil {
-		log.Printf("failed to fetch ABI from etherscan: %v\n", err)
+		recordSpanError(span, err)
+		return abi.ABI{}, common.Address{}, err
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
 
-	data, err := io.ReadAll(resp.Body)
+	span.SetAttributes(
+		attribute.String("source", res.Source),
+		attribute.Bool("proxy", proxy),
+		attribute.Int("events", len(parsed.Events)))
+	logger.Info("ABI fetched", "source", res.Source, "events", len(parsed.Events))
+
+	return parsed, res.Implementation, nil
+}
+
+// resolveABI resolves the ABI of the configured contract, through the ABI cache when
+// opts.ABI.CacheDir is set.
+func resolveABI(ctx context.Context, opts *cli.Config, refresh bool) (*ResolvedABI, error) {
+	contractAddr := opts.Query.Address
+	if contractAddr == "" {
+		return nil, errors.New("CONTRACT_ADDRESS environment variable is not set")
+	}
+	return resolveAddressABI(ctx, opts, common.HexToAddress(contractAddr), refresh)
+}
+
+// resolveAddressABI resolves the ABI of address with the configured resolvers.
+func resolveAddressABI(ctx context.Context, opts *cli.Config, address common.Address, refresh bool) (*ResolvedABI, error) {
+	chain, err := NewResolver(opts)
 	if err != nil {
-		log.Printf("failed to read from http response body: %v\n", err)
+		return nil, fmt.Errorf("invalid ABI_RESOLVERS: %w", err)
 	}
+	var resolver ABIResolver = chain
+	// Detect proxies from chain state, explorers are then only asked for plain ABIs
+	if opts.API.EthNodeURL != "" {
+		client, err := ethclient.DialContext(ctx, opts.API.EthNodeURL)
+		if err != nil {
+			logger.Warn("failed to connect to RPC node, skipping on-chain proxy detection", "err", err)
+		} else {
+			defer client.Close()
+			resolver = &ChainProxyResolver{Client: client, Resolver: chain}
+		}
+	}
+	if opts.ABI.CacheDir != "" {
+		resolver = &CachedResolver{
+			Resolver: resolver,
+			Cache:    &ABICache{Dir: opts.ABI.CacheDir},
+			ChainID:  opts.API.ChainID,
+			Refresh:  refresh,
+		}
+	}
+	return resolver.Resolve(ctx, address)
+}
 
-	// Remove verbose logging
-	result := unmarshalToMapping(data)
-	if result == "" {
+// resolveProxyABI resolves the ABI of the proxy contract itself, without following it to its
+// implementation, for the events and methods the proxy declares (upgrades, admin changes,
+// custom events). It is cached apart from the implementation ABI, under the "proxy"
+// subdirectory of the ABI cache. An unverified proxy has an empty ABI.
+func resolveProxyABI(ctx context.Context, opts *cli.Config, proxy common.Address, refresh bool) abi.ABI {
+	chain, err := NewResolver(opts)
+	if err != nil {
 		return abi.ABI{}
 	}
-
-	parsedABI, err := abi.JSON(strings.NewReader(result))
+	chain.skipProxies()
+	var resolver ABIResolver = chain
+	if opts.ABI.CacheDir != "" {
+		resolver = &CachedResolver{
+			Resolver: chain,
+			Cache:    &ABICache{Dir: filepath.Join(opts.ABI.CacheDir, "proxy")},
+			ChainID:  opts.API.ChainID,
+			Refresh:  refresh,
+		}
+	}
+	res, err := resolver.Resolve(ctx, proxy)
 	if err != nil {
-		log.Println(err)
+		logger.Warn("failed to resolve the proxy's own ABI, using the standard proxy events", "contract", proxy.Hex(), "err", err)
 		return abi.ABI{}
 	}
+	logger.Info("proxy ABI resolved", "contract", proxy.Hex(), "source", res.Source, "events", len(res.ABI.Events))
+	return res.ABI
+}
 
-	var response EtherscanResponse
-	json.Unmarshal(data, &response)
+// EtherscanResolver resolves ABIs of contracts verified on Etherscan, or on an explorer
+// exposing the same API, through the V2 multichain endpoint.
+type EtherscanResolver struct {
+	// BaseURL is the Etherscan API URL, e.g. https://api.etherscan.io/v2/api.
+	BaseURL string
+	// ChainID is sent as the chainid parameter when non-zero.
+	ChainID int64
+	APIKey  string
+	Client  *http.Client
+	// SkipProxies returns the ABI of the address itself, without checking for a proxy.
+	SkipProxies bool
+}
 
-	log.Printf("ABI fetched: status=%s message=%s events=%d\n",
-		response.Status,
-		response.Message,
-		len(parsedABI.Events))
+// Name implements ABIResolver.
+func (r *EtherscanResolver) Name() string { return "etherscan" }
 
-	return parsedABI
-}
+// Resolve implements ABIResolver. Proxies are detected with the getsourcecode action and
+// the ABI of their implementation is returned.
+func (r *EtherscanResolver) Resolve(ctx context.Context, address common.Address) (*ResolvedABI, error) {
+	if r.APIKey == "" {
+		return nil, fmt.Errorf("ETHERSCAN_API_KEY environment variable is not set: %w", ErrInvalidAPIKey)
+	}
 
-// unmarshalToMapping unmarshals the provided data (assumed to be JSON) into a map[string]string
-// and returns the value of the "result" key from the map.
-func unmarshalToMapping(data []byte) string {
+	res := &ResolvedABI{Source: r.Name()}
+	if !r.SkipProxies {
+		isProxy, implementation, err := r.proxyImplementation(ctx, address)
+		if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrInvalidAPIKey) || errors.Is(err, ErrUnsupportedChain) {
+			// getabi would fail the same way
+			return nil, err
+		}
+		if err != nil {
+			logger.Warn("failed to check whether contract is a proxy", "contract", address.Hex(), "err", err)
+		}
+		if isProxy && common.IsHexAddress(implementation) {
+			logger.Info("contract is a proxy, using the implementation ABI", "contract", address.Hex(), "implementation", implementation)
+			res.Implementation = common.HexToAddress(implementation)
+			address = res.Implementation
+		} else {
+			logger.Info("contract is not a proxy", "contract", address.Hex())
+		}
+	}
 
-	// abiMap := make(map[string]string)
-	var response struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Result  string `json:"result"`
+	var response EtherscanResponse
+	if err := getJSON(ctx, r.Client, r.url("getabi", address), &response); err != nil {
+		metrics.EtherscanRequests.WithLabelValues("getabi", "http_error").Inc()
+		return nil, err
 	}
-	// converts JSON response to Go map
-	// Unmarshal: JSON string -> Go data
-	err := json.Unmarshal(data, &response)
-	if err != nil {
-		log.Printf("failed to unmarshal data into map: %v\n", err)
+	if response.Status != "1" {
+		err := newEtherscanError("getabi", response.Message, response.Result)
+		metrics.EtherscanRequests.WithLabelValues("getabi", etherscanOutcome(err)).Inc()
+		return nil, err
 	}
 
-	// Returns only the "result" field containing actual ABI
-	return response.Result
+	if err := res.setABI([]byte(response.Result)); err != nil {
+		metrics.EtherscanRequests.WithLabelValues("getabi", "invalid_response").Inc()
+		return nil, err
+	}
+	metrics.EtherscanRequests.WithLabelValues("getabi", etherscanOutcome(nil)).Inc()
+	return res, nil
 }
 
-// func fetchByteCode(opts *cli.Config) string {
-// 	return ""
-// }
-
-func getProxyInfoAndImplementation(contractAddress, etherScanAPI string) (bool, string, error) {
-	const etherscanURLGetSourceCode = "https://api.etherscan.io/api?module=contract&action=getsourcecode&address=%s&apikey=%s"
-	getSourceCodeURL := fmt.Sprintf(etherscanURLGetSourceCode, contractAddress, etherScanAPI)
-	resp, _ := http.Get(getSourceCodeURL)
-	data, _ := io.ReadAll(resp.Body)
-
-	var responseStruct struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Result  []struct {
-			Proxy          string `json:"Proxy"`
-			Implementation string `json:"Implementation"`
-			ABI            string `json:"ABI"`
-		} `json:"result"`
+// proxyImplementation calls the getsourcecode action and reports whether the contract is a
+// proxy together with its implementation address.
+func (r *EtherscanResolver) proxyImplementation(ctx context.Context, address common.Address) (bool, string, error) {
+	var response struct {
+		Status  string          `json:"status"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := getJSON(ctx, r.Client, r.url("getsourcecode", address), &response); err != nil {
+		metrics.EtherscanRequests.WithLabelValues("getsourcecode", "http_error").Inc()
+		return false, "", err
 	}
 
-	if err := json.Unmarshal(data, &responseStruct); err != nil {
+	if response.Status != "1" {
+		// On errors the result is a plain string instead of an array
+		var result string
+		_ = json.Unmarshal(response.Result, &result)
+		err := newEtherscanError("getsourcecode", response.Message, result)
+		metrics.EtherscanRequests.WithLabelValues("getsourcecode", etherscanOutcome(err)).Inc()
 		return false, "", err
 	}
-	if len(responseStruct.Result) == 0 {
-		return false, "", fmt.Errorf("no result in etherscan response")
+
+	var results []struct {
+		Proxy          string `json:"Proxy"`
+		Implementation string `json:"Implementation"`
 	}
-	r := responseStruct.Result[0]
-	isProxy := false
-	if r.Proxy == "1" || strings.EqualFold(r.Proxy, "true") {
-		isProxy = true
+	if err := json.Unmarshal(response.Result, &results); err != nil || len(results) == 0 {
+		metrics.EtherscanRequests.WithLabelValues("getsourcecode", "invalid_response").Inc()
+		return false, "", fmt.Errorf("no result in etherscan response: %s", response.Message)
+	}
+	metrics.EtherscanRequests.WithLabelValues("getsourcecode", etherscanOutcome(nil)).Inc()
+	proxy := results[0].Proxy == "1" || strings.EqualFold(results[0].Proxy, "true")
+	return proxy, results[0].Implementation, nil
+}
+
+func (r *EtherscanResolver) url(action string, address common.Address) string {
+	q := url.Values{}
+	if r.ChainID != 0 {
+		q.Set("chainid", strconv.FormatInt(r.ChainID, 10))
+	}
+	q.Set("module", "contract")
+	q.Set("action", action)
+	q.Set("address", address.Hex())
+	q.Set("apikey", r.APIKey)
+	return r.BaseURL + "?" + q.Encode()
+}
+
+// etherscanOutcome maps the result of an Etherscan call to a metrics outcome label.
+func etherscanOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrInvalidAPIKey):
+		return "invalid_key"
+	case errors.Is(err, ErrUnsupportedChain):
+		return "unsupported_chain"
+	case errors.Is(err, ErrContractNotVerified):
+		return "not_verified"
+	default:
+		return "api_error"
 	}
-	return isProxy, r.Implementation, nil
 }
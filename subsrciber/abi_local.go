@@ -0,0 +1,257 @@
+package subsrciber
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+// loadABI builds the contract ABI from the configured source: a local ABI or artifact file,
+// inline event signatures, or the ABI resolvers when no local source is set. Local sources make
+// no network call, so unverified and private contracts can be indexed without an API key.
+// The implementation is set when the resolvers found the contract to be a proxy.
+func loadABI(opts *cli.Config, refresh bool) (abi.ABI, common.Address, error) {
+	switch {
+	case opts.ABI.File != "":
+		parsed, err := loadABIFile(opts.ABI.File)
+		if err != nil {
+			return abi.ABI{}, common.Address{}, err
+		}
+		logger.Info("ABI loaded from file", "file", opts.ABI.File, "events", len(parsed.Events))
+		parsed, err = decoderABI(opts, parsed, nil)
+		return parsed, common.Address{}, err
+	case len(opts.ABI.Signatures) > 0:
+		parsed, err := parseEventSignatures(opts.ABI.Signatures)
+		if err != nil {
+			return abi.ABI{}, common.Address{}, fmt.Errorf("failed to parse event signatures: %w", err)
+		}
+		logger.Info("ABI built from event signatures", "events", len(parsed.Events))
+		parsed, err = decoderABI(opts, parsed, nil)
+		return parsed, common.Address{}, err
+	default:
+		return fetchABI(opts, refresh)
+	}
+}
+
+// LoadABI returns the decoder ABI of the configured contract, from the same source as the
+// indexer: local file, event signatures or resolvers (through the ABI cache), merged with
+// the proxy events and opts.ABI.Extra.
+func LoadABI(opts *cli.Config) (abi.ABI, error) {
+	parsed, _, err := loadABI(opts, false)
+	return parsed, err
+}
+
+// loadABIFile reads a contract ABI from disk. The file is either a plain ABI JSON array or a
+// build artifact (Hardhat, Foundry, Truffle) holding the ABI under its "abi" key.
+func loadABIFile(path string) (abi.ABI, error) {
+	data, err := readABIFile(path)
+	if err != nil {
+		return abi.ABI{}, err
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(string(data)))
+	if err != nil {
+		return abi.ABI{}, fmt.Errorf("failed to parse ABI in %s: %w", path, err)
+	}
+	return parsed, nil
+}
+
+// readABIFile returns the ABI JSON array held by an ABI or artifact file.
+func readABIFile(path string) (json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		return json.RawMessage(trimmed), nil
+	}
+	var artifact struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, fmt.Errorf("%s is neither an ABI nor an artifact: %w", path, err)
+	}
+	if len(artifact.ABI) == 0 {
+		return nil, fmt.Errorf("%s has no \"abi\" field", path)
+	}
+	return artifact.ABI, nil
+}
+
+// abiArgument is the JSON form of an ABI parameter.
+type abiArgument struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Indexed    bool          `json:"indexed,omitempty"`
+	Components []abiArgument `json:"components,omitempty"`
+}
+
+// abiEvent is the JSON form of an ABI event.
+type abiEvent struct {
+	Type      string        `json:"type"`
+	Name      string        `json:"name"`
+	Inputs    []abiArgument `json:"inputs"`
+	Anonymous bool          `json:"anonymous"`
+}
+
+// parseEventSignatures builds an ABI from human-readable event signatures such as
+// "Transfer(address indexed from, address indexed to, uint256 value)". The "event" prefix,
+// parameter names and a trailing "anonymous" are optional; unnamed parameters are named
+// arg0, arg1, ... Tuples are written as parenthesised lists, e.g. "(uint256,address)[]".
+func parseEventSignatures(signatures []string) (abi.ABI, error) {
+	events := make([]abiEvent, 0, len(signatures))
+	for _, sig := range signatures {
+		sig = strings.TrimSpace(sig)
+		if sig == "" {
+			continue
+		}
+		ev, err := parseEventSignature(sig)
+		if err != nil {
+			return abi.ABI{}, fmt.Errorf("invalid event signature %q: %w", sig, err)
+		}
+		events = append(events, ev)
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	return abi.JSON(strings.NewReader(string(data)))
+}
+
+func parseEventSignature(sig string) (abiEvent, error) {
+	sig = strings.TrimSpace(strings.TrimPrefix(sig, "event "))
+	open := strings.Index(sig, "(")
+	if open <= 0 {
+		return abiEvent{}, fmt.Errorf("missing event name or parameter list")
+	}
+	ev := abiEvent{Type: "event", Name: strings.TrimSpace(sig[:open])}
+
+	closing := matchingParen(sig, open)
+	if closing < 0 {
+		return abiEvent{}, fmt.Errorf("unbalanced parentheses")
+	}
+	switch rest := strings.TrimSpace(sig[closing+1:]); rest {
+	case "":
+	case "anonymous":
+		ev.Anonymous = true
+	default:
+		return abiEvent{}, fmt.Errorf("unexpected %q after parameter list", rest)
+	}
+
+	inputs, err := parseParams(sig[open+1:closing], true)
+	if err != nil {
+		return abiEvent{}, err
+	}
+	ev.Inputs = inputs
+	return ev, nil
+}
+
+// parseParams parses a comma separated parameter list. indexed is allowed only at the top level.
+func parseParams(list string, allowIndexed bool) ([]abiArgument, error) {
+	args := []abiArgument{}
+	if strings.TrimSpace(list) == "" {
+		return args, nil
+	}
+	for i, param := range splitTopLevel(list) {
+		arg, err := parseParam(strings.TrimSpace(param), allowIndexed)
+		if err != nil {
+			return nil, err
+		}
+		if arg.Name == "" {
+			arg.Name = fmt.Sprintf("arg%d", i)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func parseParam(param string, allowIndexed bool) (abiArgument, error) {
+	var arg abiArgument
+	var rest string
+	if strings.HasPrefix(param, "(") {
+		closing := matchingParen(param, 0)
+		if closing < 0 {
+			return arg, fmt.Errorf("unbalanced parentheses in %q", param)
+		}
+		components, err := parseParams(param[1:closing], false)
+		if err != nil {
+			return arg, err
+		}
+		// array suffixes directly follow the closing parenthesis, e.g. (uint256,address)[]
+		suffixEnd := closing + 1
+		for suffixEnd < len(param) && param[suffixEnd] != ' ' {
+			suffixEnd++
+		}
+		arg.Type = "tuple" + param[closing+1:suffixEnd]
+		arg.Components = components
+		rest = param[suffixEnd:]
+	} else {
+		fields := strings.Fields(param)
+		if len(fields) == 0 {
+			return arg, fmt.Errorf("empty parameter")
+		}
+		arg.Type = fields[0]
+		rest = strings.Join(fields[1:], " ")
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) > 0 && fields[0] == "indexed" {
+		if !allowIndexed {
+			return arg, fmt.Errorf("indexed is only allowed on event parameters")
+		}
+		arg.Indexed = true
+		fields = fields[1:]
+	}
+	switch len(fields) {
+	case 0:
+	case 1:
+		arg.Name = fields[0]
+	default:
+		return arg, fmt.Errorf("unexpected %q in parameter %q", strings.Join(fields, " "), param)
+	}
+	return arg, nil
+}
+
+// splitTopLevel splits s on commas that are not nested inside parentheses.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// matchingParen returns the index of the parenthesis closing the one at open, or -1.
+func matchingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
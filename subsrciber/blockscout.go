@@ -0,0 +1,74 @@
+package subsrciber
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// BlockscoutResolver resolves ABIs of contracts verified on a Blockscout explorer through
+// its v2 REST API.
+type BlockscoutResolver struct {
+	// BaseURL is the explorer URL, e.g. https://eth.blockscout.com.
+	BaseURL string
+	Client  *http.Client
+	// SkipProxies returns the ABI of the address itself, without following its implementation.
+	SkipProxies bool
+}
+
+type blockscoutContract struct {
+	ABI             json.RawMessage `json:"abi"`
+	Implementations []struct {
+		Address string `json:"address"`
+	} `json:"implementations"`
+	// ImplementationAddress is returned by older Blockscout versions.
+	ImplementationAddress string `json:"implementation_address"`
+}
+
+func (c *blockscoutContract) implementation() string {
+	if len(c.Implementations) > 0 {
+		return c.Implementations[0].Address
+	}
+	return c.ImplementationAddress
+}
+
+// Name implements ABIResolver.
+func (r *BlockscoutResolver) Name() string { return "blockscout" }
+
+// Resolve implements ABIResolver.
+func (r *BlockscoutResolver) Resolve(ctx context.Context, address common.Address) (*ResolvedABI, error) {
+	contract, err := r.contract(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ResolvedABI{Source: r.Name()}
+	if impl := contract.implementation(); !r.SkipProxies && impl != "" && common.IsHexAddress(impl) {
+		res.Implementation = common.HexToAddress(impl)
+		logger.Info("contract is a proxy, using the implementation ABI", "resolver", r.Name(), "contract", address.Hex(), "implementation", impl)
+		if contract, err = r.contract(ctx, res.Implementation); err != nil {
+			return nil, fmt.Errorf("implementation %s: %w", impl, err)
+		}
+	}
+
+	if len(contract.ABI) == 0 || string(contract.ABI) == "null" {
+		return nil, ErrABINotFound
+	}
+	if err := res.setABI(contract.ABI); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *BlockscoutResolver) contract(ctx context.Context, address common.Address) (*blockscoutContract, error) {
+	url := fmt.Sprintf("%s/api/v2/smart-contracts/%s", strings.TrimSuffix(r.BaseURL, "/"), address.Hex())
+	var contract blockscoutContract
+	if err := getJSON(ctx, r.Client, url, &contract); err != nil {
+		return nil, err
+	}
+	return &contract, nil
+}
@@ -0,0 +1,185 @@
+package subsrciber
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+// CachedABI is an ABI cache entry, stored as JSON in <dir>/<chainID>/<address>.json.
+type CachedABI struct {
+	ChainID        int64          `json:"chainId"`
+	Address        common.Address `json:"address"`
+	Implementation common.Address `json:"implementation"`
+	Source         string         `json:"source"`
+	FetchedAt      time.Time      `json:"fetchedAt"`
+	// Pinned entries are never replaced by a refresh.
+	Pinned bool            `json:"pinned"`
+	ABI    json.RawMessage `json:"abi"`
+}
+
+// ABICache stores resolved ABIs on disk so restarts make no explorer calls.
+type ABICache struct {
+	Dir string
+}
+
+func (c *ABICache) path(chainID int64, address common.Address) string {
+	return filepath.Join(c.Dir, strconv.FormatInt(chainID, 10), strings.ToLower(address.Hex())+".json")
+}
+
+// Get returns the cached entry, or an error wrapping os.ErrNotExist when there is none.
+func (c *ABICache) Get(chainID int64, address common.Address) (*CachedABI, error) {
+	data, err := os.ReadFile(c.path(chainID, address))
+	if err != nil {
+		return nil, err
+	}
+	var entry CachedABI
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("corrupt ABI cache entry %s: %w", c.path(chainID, address), err)
+	}
+	return &entry, nil
+}
+
+// Put writes the entry, replacing any previous one.
+func (c *ABICache) Put(entry *CachedABI) error {
+	path := c.path(entry.ChainID, entry.Address)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a truncated entry behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// resolved converts the entry back to a resolver result.
+func (e *CachedABI) resolved() (*ResolvedABI, error) {
+	res := &ResolvedABI{Source: e.Source, Implementation: e.Implementation}
+	if err := res.setABI(e.ABI); err != nil {
+		return nil, fmt.Errorf("cached ABI: %w", err)
+	}
+	return res, nil
+}
+
+// CachedResolver serves ABIs from an ABICache, calling Resolver on a miss and storing its
+// result. With Refresh set the cache is bypassed, except for pinned entries.
+type CachedResolver struct {
+	Resolver ABIResolver
+	Cache    *ABICache
+	ChainID  int64
+	Refresh  bool
+}
+
+// Name implements ABIResolver.
+func (r *CachedResolver) Name() string { return "cache," + r.Resolver.Name() }
+
+// Resolve implements ABIResolver.
+func (r *CachedResolver) Resolve(ctx context.Context, address common.Address) (*ResolvedABI, error) {
+	entry, err := r.Cache.Get(r.ChainID, address)
+	switch {
+	case err == nil && (entry.Pinned || !r.Refresh):
+		logger.Info("using cached ABI", "contract", address.Hex(), "source", entry.Source, "fetched_at", entry.FetchedAt, "pinned", entry.Pinned)
+		return entry.resolved()
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		logger.Warn("ignoring ABI cache entry", "contract", address.Hex(), "err", err)
+	}
+
+	res, err := r.Resolver.Resolve(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	err = r.Cache.Put(&CachedABI{
+		ChainID:        r.ChainID,
+		Address:        address,
+		Implementation: res.Implementation,
+		Source:         res.Source,
+		FetchedAt:      time.Now().UTC(),
+		ABI:            res.JSON,
+	})
+	if err != nil {
+		logger.Warn("failed to cache ABI", "contract", address.Hex(), "err", err)
+	}
+	return res, nil
+}
+
+// RefreshABI resolves the contract ABI again and replaces the cached entry. Pinned entries
+// are returned unchanged.
+func RefreshABI(ctx context.Context, opts *cli.Config) (*CachedABI, error) {
+	if opts.ABI.CacheDir == "" {
+		return nil, errors.New("ABI cache is disabled")
+	}
+	if _, err := resolveABI(ctx, opts, true); err != nil {
+		return nil, err
+	}
+	cache := &ABICache{Dir: opts.ABI.CacheDir}
+	return cache.Get(opts.API.ChainID, common.HexToAddress(opts.Query.Address))
+}
+
+// PinABI pins the cached ABI of the contract so it is used until unpinned. When file is
+// set the ABI (or artifact) in file replaces the cached one, otherwise the current entry
+// is pinned, resolving it first when the cache has none.
+func PinABI(ctx context.Context, opts *cli.Config, file string) (*CachedABI, error) {
+	if opts.ABI.CacheDir == "" {
+		return nil, errors.New("ABI cache is disabled")
+	}
+	cache := &ABICache{Dir: opts.ABI.CacheDir}
+	address := common.HexToAddress(opts.Query.Address)
+
+	var entry *CachedABI
+	if file != "" {
+		data, err := readABIFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := abi.JSON(strings.NewReader(string(data))); err != nil {
+			return nil, fmt.Errorf("failed to parse ABI in %s: %w", file, err)
+		}
+		entry = &CachedABI{
+			ChainID:   opts.API.ChainID,
+			Address:   address,
+			Source:    "file:" + file,
+			FetchedAt: time.Now().UTC(),
+			ABI:       data,
+		}
+	} else {
+		if _, err := resolveABI(ctx, opts, false); err != nil {
+			return nil, err
+		}
+		var err error
+		if entry, err = cache.Get(opts.API.ChainID, address); err != nil {
+			return nil, err
+		}
+	}
+	entry.Pinned = true
+	return entry, cache.Put(entry)
+}
+
+// UnpinABI clears the pin of the cached ABI so the next refresh replaces it.
+func UnpinABI(opts *cli.Config) (*CachedABI, error) {
+	if opts.ABI.CacheDir == "" {
+		return nil, errors.New("ABI cache is disabled")
+	}
+	cache := &ABICache{Dir: opts.ABI.CacheDir}
+	entry, err := cache.Get(opts.API.ChainID, common.HexToAddress(opts.Query.Address))
+	if err != nil {
+		return nil, err
+	}
+	entry.Pinned = false
+	return entry, cache.Put(entry)
+}
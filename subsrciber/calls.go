@@ -0,0 +1,246 @@
+package subsrciber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/naman1402/geth-indexer/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// callPollInterval is how often the chain head is checked for new blocks to scan for calls
+const callPollInterval = 12 * time.Second
+
+// Call is calldata sent to the contract, decoded with the method section of its ABI.
+type Call struct {
+	// Method is the ABI name of the called method (overloads are suffixed, like events). It
+	// is empty when the calldata has no selector, e.g. plain ether transfers, or when the
+	// selector is not in the ABI.
+	Method string
+	// Signature is the canonical signature, e.g. "transfer(address,uint256)".
+	Signature string
+	// Selector is the 0x-prefixed hex of the first four bytes of the calldata, empty when
+	// the calldata is shorter.
+	Selector string
+	// Inputs are the ABI arguments the call was decoded with.
+	Inputs abi.Arguments
+	// Args are the decoded arguments keyed by name ("arg<i>" when unnamed), in the
+	// decoded-value model of Event.Data.
+	Args map[string]interface{}
+}
+
+// DecodeCall decodes input, the calldata of a call to the contract, with the ABI active at
+// block. When the arguments cannot be decoded the call is returned without them, with the
+// error.
+func (c *Contract) DecodeCall(block uint64, input []byte) (*Call, error) {
+	call := &Call{}
+	if len(input) < 4 {
+		return call, nil
+	}
+	call.Selector = hexutil.Encode(input[:4])
+
+	c.mu.RLock()
+	parsed, _ := c.at(block)
+	c.mu.RUnlock()
+	method, err := parsed.MethodById(input[:4])
+	if err != nil {
+		return call, nil
+	}
+	call.Method, call.Signature, call.Inputs = method.Name, method.Sig, method.Inputs
+
+	values, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return call, fmt.Errorf("failed to unpack %s calldata: %w", method.Sig, err)
+	}
+	args := make(map[string]interface{}, len(values))
+	for i, arg := range method.Inputs {
+		v, err := normalizeValue(arg.Type, values[i])
+		if err != nil {
+			return call, fmt.Errorf("%s argument %s: %w", method.Sig, ArgumentName(arg, i), err)
+		}
+		args[ArgumentName(arg, i)] = v
+	}
+	call.Args = args
+	return call, nil
+}
+
+// rpcBlock is the part of an eth_getBlockByNumber result with full transactions read by
+// CallScanner.
+type rpcBlock struct {
+	Transactions []*rpcTransaction `json:"transactions"`
+}
+
+// CallScanner finds the transactions sent to the contract by reading every block, whether
+// they emitted an event or not and reverted ones included, and decodes their calldata with
+// the contract ABI. Calls made by other contracts are not transactions, see CallTracer.
+type CallScanner struct {
+	client    *rpc.Client
+	contract  *Contract
+	batchSize int
+}
+
+// NewCallScanner returns a CallScanner for c fetching up to batchSize blocks, and then
+// receipts, per batched JSON-RPC call.
+func NewCallScanner(client *rpc.Client, c *Contract, batchSize int) *CallScanner {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	return &CallScanner{client: client, contract: c, batchSize: batchSize}
+}
+
+// Run sends the transactions sent to the contract in the blocks in [from, to] to callCh, in
+// block and transaction order, with Transaction.Call set. A from of 0 starts at the chain
+// head and a to of 0 keeps scanning new blocks. It returns nil once to is scanned or ctx is
+// done, and the error of the first blocks that cannot be read.
+func (s *CallScanner) Run(ctx context.Context, from, to uint64, callCh chan<- *Transaction) error {
+	next := from
+	for {
+		last := to
+		if last == 0 {
+			var head hexutil.Uint64
+			err := s.client.CallContext(ctx, &head, "eth_blockNumber")
+			metrics.ObserveRPC("eth_blockNumber", err)
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case err != nil:
+				logger.Warn("failed to fetch chain head for call scanning", "err", err)
+			default:
+				last = uint64(head)
+				if next == 0 {
+					next = last
+				}
+			}
+		}
+
+		for last != 0 && next <= last {
+			end := min(next+uint64(s.batchSize)-1, last)
+			txs, err := s.Calls(ctx, next, end)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("failed to scan blocks %d-%d for calls: %w", next, end, err)
+			}
+			logger.Debug("scanned blocks for calls", "from", next, "to", end, "calls", len(txs))
+			for _, tx := range txs {
+				select {
+				case callCh <- tx:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+			next = end + 1
+		}
+		if to != 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(callPollInterval):
+		}
+	}
+}
+
+// Calls returns the transactions sent to the contract in the blocks in [from, to], with
+// their receipt and decoded call, in block and transaction order.
+func (s *CallScanner) Calls(ctx context.Context, from, to uint64) ([]*Transaction, error) {
+	ctx, span := tracer.Start(ctx, "subscriber.calls", trace.WithAttributes(
+		attribute.Int64("from", int64(from)), attribute.Int64("to", int64(to))))
+	defer span.End()
+
+	txs, err := s.blockCalls(ctx, from, to)
+	if err == nil {
+		err = s.receipts(ctx, txs)
+	}
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	out := make([]*Transaction, len(txs))
+	for i, tx := range txs {
+		out[i] = tx.tx
+		call, err := s.contract.DecodeCall(tx.tx.BlockNumber, tx.tx.Input)
+		if err != nil {
+			logger.Warn("failed to decode calldata", "txn", tx.tx.Hash.Hex(), "selector", call.Selector, "err", err)
+		}
+		out[i].Call = call
+	}
+	span.SetAttributes(attribute.Int("calls", len(out)))
+	return out, nil
+}
+
+// scannedCall is a transaction sent to the contract waiting for its receipt.
+type scannedCall struct {
+	raw *rpcTransaction
+	tx  *Transaction
+}
+
+// blockCalls reads the blocks in [from, to] in one batch call and returns their
+// transactions sent to the contract.
+func (s *CallScanner) blockCalls(ctx context.Context, from, to uint64) ([]*scannedCall, error) {
+	blocks := make([]*rpcBlock, to-from+1)
+	batch := make([]rpc.BatchElem, len(blocks))
+	for i := range batch {
+		batch[i] = rpc.BatchElem{Method: "eth_getBlockByNumber", Args: []interface{}{hexutil.Uint64(from + uint64(i)), true}, Result: &blocks[i]}
+	}
+	if err := s.client.BatchCallContext(ctx, batch); err != nil {
+		metrics.ObserveRPC("eth_getBlockByNumber", err)
+		return nil, err
+	}
+
+	var calls []*scannedCall
+	for i, elem := range batch {
+		metrics.ObserveRPC(elem.Method, elem.Error)
+		if elem.Error != nil {
+			return nil, fmt.Errorf("failed to fetch block %d: %w", from+uint64(i), elem.Error)
+		}
+		if blocks[i] == nil {
+			return nil, fmt.Errorf("block %d not found", from+uint64(i))
+		}
+		for _, tx := range blocks[i].Transactions {
+			if tx != nil && tx.To != nil && *tx.To == s.contract.Address {
+				calls = append(calls, &scannedCall{raw: tx})
+			}
+		}
+	}
+	return calls, nil
+}
+
+// receipts fetches the receipts of calls in batches and sets their transactions.
+func (s *CallScanner) receipts(ctx context.Context, calls []*scannedCall) error {
+	for start := 0; start < len(calls); start += s.batchSize {
+		chunk := calls[start:min(start+s.batchSize, len(calls))]
+		receipts := make([]*rpcReceipt, len(chunk))
+		batch := make([]rpc.BatchElem, len(chunk))
+		for i, c := range chunk {
+			batch[i] = rpc.BatchElem{Method: "eth_getTransactionReceipt", Args: []interface{}{c.raw.Hash}, Result: &receipts[i]}
+		}
+		if err := s.client.BatchCallContext(ctx, batch); err != nil {
+			metrics.ObserveRPC("eth_getTransactionReceipt", err)
+			return err
+		}
+		for i, c := range chunk {
+			elem := batch[i]
+			metrics.ObserveRPC(elem.Method, elem.Error)
+			err := elem.Error
+			if err == nil && receipts[i] == nil {
+				err = errors.New("receipt not found")
+			}
+			if err != nil {
+				return fmt.Errorf("failed to fetch receipt of %s: %w", c.raw.Hash.Hex(), err)
+			}
+			c.tx = newTransaction(c.raw.Hash, c.raw, receipts[i])
+		}
+	}
+	return nil
+}
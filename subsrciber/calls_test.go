@@ -0,0 +1,162 @@
+package subsrciber
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// callBlocks are the transactions of the blocks served by rpcServer: a withdrawal emitting a
+// Withdrawal event, a reverted withdrawal and a balanceOf call, which emit none, and a
+// transfer of another token.
+var callBlocks = map[string][]map[string]string{
+	"0x64": {
+		{"hash": "0x1", "to": "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", "input": "0x2e1a7d4d00000000000000000000000000000000000000000000000006f05b59d3b20000"},
+		{"hash": "0x2", "to": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", "input": "0x"},
+	},
+	"0x65": {},
+	"0x66": {
+		{"hash": "0x3", "to": "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", "input": "0x2e1a7d4d00000000000000000000000000000000000000000000003635c9adc5dea00000"},
+		{"hash": "0x4", "to": "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", "input": "0x70a08231000000000000000000000000b4e16d0168e52d35cacd2c6185b44281ec28c9dc"},
+	},
+}
+
+// callStatuses are the receipt statuses of the calls to the contract.
+var callStatuses = map[string]string{"0x1": "0x1", "0x3": "0x0", "0x4": "0x1"}
+
+type rpcMessage struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// rpcServer serves the batched eth_getBlockByNumber and eth_getTransactionReceipt calls of
+// the CallScanner from callBlocks, and counts the batches of each method.
+func rpcServer(t *testing.T) (*rpc.Client, map[string]int) {
+	t.Helper()
+	batches := make(map[string]int)
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var msgs []rpcMessage
+		if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil {
+			t.Errorf("expected a batch call: %v", err)
+			return
+		}
+		batches[msgs[0].Method]++
+		out := make([]map[string]interface{}, len(msgs))
+		for i, msg := range msgs {
+			var key string
+			_ = json.Unmarshal(msg.Params[0], &key)
+			var result interface{}
+			switch msg.Method {
+			case "eth_getBlockByNumber":
+				if txs, ok := callBlocks[key]; ok {
+					full := make([]map[string]string, len(txs))
+					for j, tx := range txs {
+						full[j] = map[string]string{"blockNumber": key, "from": "0x7a250d5630b4cf539739df2c5dacb4c659f2488d",
+							"nonce": "0x1", "value": "0x0", "gasPrice": "0x3b9aca00"}
+						for k, v := range tx {
+							full[j][k] = v
+						}
+						full[j]["hash"] = fmt.Sprintf("0x%064s", strings.TrimPrefix(tx["hash"], "0x"))
+					}
+					result = map[string]interface{}{"transactions": full}
+				}
+			case "eth_getTransactionReceipt":
+				if status, ok := callStatuses["0x"+strings.TrimLeft(strings.TrimPrefix(key, "0x"), "0")]; ok {
+					result = map[string]string{"gasUsed": "0x5208", "effectiveGasPrice": "0x3b9aca00", "status": status}
+				}
+			}
+			out[i] = map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result}
+		}
+		writeJSON(w, out)
+	})
+	client, err := rpc.Dial(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client, batches
+}
+
+func wethContract(t *testing.T) *Contract {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(wethABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Contract{Address: wethAddress, ABI: parsed}
+}
+
+func TestCallScannerCalls(t *testing.T) {
+	client, batches := rpcServer(t)
+	calls, err := NewCallScanner(client, wethContract(t), 10).Calls(context.Background(), 100, 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// calls emitting no event and reverted ones are found, the other token's transfer is not
+	want := []string{
+		"100 0x1 status=1 withdraw map[wad:500000000000000000]",
+		"102 0x3 status=0 withdraw map[wad:1000000000000000000000]",
+		"102 0x4 status=1 balanceOf map[arg0:0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc]",
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got %d calls, want %d", len(calls), len(want))
+	}
+	for i, tx := range calls {
+		got := fmt.Sprintf("%d 0x%s status=%d %s %v", tx.BlockNumber, strings.TrimLeft(tx.Hash.Hex()[2:], "0"),
+			tx.Status, tx.Call.Method, tx.Call.Args)
+		if got != want[i] {
+			t.Errorf("call %d: got %q, want %q", i, got, want[i])
+		}
+	}
+	if batches["eth_getBlockByNumber"] != 1 || batches["eth_getTransactionReceipt"] != 1 {
+		t.Errorf("got batches %v, want one per method", batches)
+	}
+}
+
+func TestCallScannerBatches(t *testing.T) {
+	client, batches := rpcServer(t)
+	calls, err := NewCallScanner(client, wethContract(t), 2).Calls(context.Background(), 100, 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(calls))
+	}
+	// Calls reads its range in one batch, Run splits ranges by batch size
+	if batches["eth_getTransactionReceipt"] != 2 {
+		t.Errorf("got %d receipt batches, want 2", batches["eth_getTransactionReceipt"])
+	}
+
+	callCh := make(chan *Transaction, 10)
+	if err := NewCallScanner(client, wethContract(t), 2).Run(context.Background(), 100, 102, callCh); err != nil {
+		t.Fatal(err)
+	}
+	close(callCh)
+	var hashes []string
+	for tx := range callCh {
+		hashes = append(hashes, strings.TrimLeft(tx.Hash.Hex()[2:], "0"))
+	}
+	if fmt.Sprint(hashes) != "[1 3 4]" {
+		t.Errorf("got calls %v, want [1 3 4]", hashes)
+	}
+}
+
+func TestCallScannerMissingBlock(t *testing.T) {
+	client, _ := rpcServer(t)
+	_, err := NewCallScanner(client, wethContract(t), 10).Calls(context.Background(), 102, 103)
+	if err == nil || !strings.Contains(err.Error(), "block 103 not found") {
+		t.Errorf("got error %v, want block 103 not found", err)
+	}
+	err = NewCallScanner(client, wethContract(t), 10).Run(context.Background(), 102, 103, make(chan *Transaction, 10))
+	if err == nil || !strings.Contains(err.Error(), "failed to scan blocks 102-103") {
+		t.Errorf("got error %v, want the failed range", err)
+	}
+}
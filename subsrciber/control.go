@@ -0,0 +1,149 @@
+package subsrciber
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNotRunning is returned by Controller requests made while Subscribe is not running.
+var ErrNotRunning = errors.New("subscriber is not running")
+
+type backfillRequest struct {
+	from, to uint64
+}
+
+// Controller steers a running Subscribe loop: it pauses and resumes ingestion,
+// schedules backfills and reloads the contract ABI. It also reports the loop's
+// connection status for health checks.
+type Controller struct {
+	mu     sync.Mutex
+	paused bool
+	// skippedFrom is the lowest block of a log dropped while paused, 0 if none
+	skippedFrom uint64
+
+	backfills chan backfillRequest
+	reloads   chan chan reloadResult
+	running   atomic.Int32
+	// active is set while the Subscribe loop is consuming requests
+	active atomic.Bool
+	// rpcConnected is set while the last call to the node succeeded
+	rpcConnected atomic.Bool
+	// subscribed is set while the live log subscription is healthy
+	subscribed atomic.Bool
+}
+
+// Status reports the subscriber's connectivity.
+type Status struct {
+	// RPCConnected is true when the last call to the Ethereum node succeeded.
+	RPCConnected bool
+	// Subscribed is true while the live log subscription has not failed.
+	Subscribed bool
+}
+
+type reloadResult struct {
+	events int
+	err    error
+}
+
+// NewController returns a Controller to be passed to Subscribe.
+func NewController() *Controller {
+	return &Controller{
+		backfills: make(chan backfillRequest, 16),
+		reloads:   make(chan chan reloadResult),
+	}
+}
+
+// Pause stops forwarding logs to the event channel. Logs received while paused are
+// dropped and backfilled on Resume.
+func (ctl *Controller) Pause() {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	ctl.paused = true
+}
+
+// Resume forwards logs again and schedules a backfill from the first block skipped
+// while paused up to the chain head.
+func (ctl *Controller) Resume() error {
+	ctl.mu.Lock()
+	from := ctl.skippedFrom
+	ctl.paused = false
+	ctl.skippedFrom = 0
+	ctl.mu.Unlock()
+
+	if from == 0 {
+		return nil
+	}
+	return ctl.Backfill(from, 0)
+}
+
+// Paused reports whether ingestion is paused.
+func (ctl *Controller) Paused() bool {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	return ctl.paused
+}
+
+// Status returns the current connectivity of the subscriber.
+func (ctl *Controller) Status() Status {
+	return Status{
+		RPCConnected: ctl.rpcConnected.Load(),
+		Subscribed:   ctl.subscribed.Load(),
+	}
+}
+
+// RunningBackfills returns the number of backfills in progress.
+func (ctl *Controller) RunningBackfills() int {
+	return int(ctl.running.Load())
+}
+
+// Backfill schedules re-fetching logs in [from, to]. A to of 0 means the chain head.
+func (ctl *Controller) Backfill(from, to uint64) error {
+	if !ctl.active.Load() {
+		return ErrNotRunning
+	}
+	if to != 0 && to < from {
+		return errors.New("backfill range ends before it starts")
+	}
+	select {
+	case ctl.backfills <- backfillRequest{from: from, to: to}:
+		return nil
+	default:
+		return errors.New("too many pending backfills")
+	}
+}
+
+// ReloadABI fetches the contract ABI again and swaps it into the decoder.
+// It returns the number of events in the new ABI.
+func (ctl *Controller) ReloadABI(ctx context.Context) (int, error) {
+	if !ctl.active.Load() {
+		return 0, ErrNotRunning
+	}
+	done := make(chan reloadResult, 1)
+	select {
+	case ctl.reloads <- done:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	select {
+	case res := <-done:
+		return res.events, res.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// skip reports whether a log of the given block must be dropped because ingestion is
+// paused, remembering the block so it is backfilled on Resume.
+func (ctl *Controller) skip(block uint64) bool {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if !ctl.paused {
+		return false
+	}
+	if ctl.skippedFrom == 0 || block < ctl.skippedFrom {
+		ctl.skippedFrom = block
+	}
+	return true
+}
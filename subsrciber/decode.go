@@ -0,0 +1,220 @@
+package subsrciber
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	addressType = reflect.TypeOf(common.Address{})
+	hashType    = reflect.TypeOf(common.Hash{})
+	bigType     = reflect.TypeOf(big.Int{})
+)
+
+// Matches reports whether e is selected by selector, which is written like the requested
+// events: ABI name ("Transfer0"), source name ("Transfer", every overload) or signature.
+func (e *Event) Matches(selector string) bool {
+	if strings.Contains(selector, "(") {
+		return strings.ReplaceAll(selector, " ", "") == e.Signature
+	}
+	rawName, _, _ := strings.Cut(e.Signature, "(")
+	return selector == e.Name || selector == rawName
+}
+
+// Decode stores the decoded data of e in the struct pointed to by v. Struct fields are
+// matched to event fields by their `abi:"name"` tag, or by name ignoring case; `abi:"-"`
+// skips a field. Values are converted from the decoded-value model (values.go):
+//   - integers to *big.Int, big.Int, any Go integer type they fit in, float64 or string
+//   - addresses to common.Address or string
+//   - bytes and bytes<N> to []byte, [N]byte, common.Hash or string
+//   - arrays to slices and Go arrays, tuples to structs, decoded the same way
+//
+// Fields missing from the event are left untouched.
+func (e *Event) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode %s: target must be a non-nil pointer to a struct, got %T", e.Name, v)
+	}
+	if err := decodeStruct(rv.Elem(), e.Data); err != nil {
+		return fmt.Errorf("decode %s: %w", e.Name, err)
+	}
+	return nil
+}
+
+// decodeStruct assigns the values of data to the matching fields of dst.
+func decodeStruct(dst reflect.Value, data map[string]interface{}) error {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, tagged := field.Tag.Lookup("abi")
+		if name == "-" {
+			continue
+		}
+		var (
+			value interface{}
+			found bool
+		)
+		if tagged {
+			value, found = data[name]
+		} else {
+			for k, v := range data {
+				if strings.EqualFold(k, field.Name) {
+					value, found, name = v, true, k
+					break
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+		if err := assign(dst.Field(i), value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// assign converts a decoded value to the type of dst and stores it.
+func assign(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		return nil
+	}
+	t := dst.Type()
+	switch {
+	case t.Kind() == reflect.Interface:
+		if !reflect.TypeOf(src).AssignableTo(t) {
+			break
+		}
+		dst.Set(reflect.ValueOf(src))
+		return nil
+	case t == bigType:
+		if n, ok := src.(*big.Int); ok {
+			dst.Set(reflect.ValueOf(*new(big.Int).Set(n)))
+			return nil
+		}
+	case t.Kind() == reflect.Ptr:
+		elem := reflect.New(t.Elem())
+		if err := assign(elem.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	case t == addressType:
+		if s, ok := src.(string); ok && common.IsHexAddress(s) {
+			dst.Set(reflect.ValueOf(common.HexToAddress(s)))
+			return nil
+		}
+	case t == hashType:
+		if b, ok := hexValue(src); ok && len(b) <= common.HashLength {
+			dst.Set(reflect.ValueOf(common.BytesToHash(b)))
+			return nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		switch s := src.(type) {
+		case *big.Int:
+			dst.SetString(s.String())
+			return nil
+		default:
+			if rv := reflect.ValueOf(src); rv.Kind() == reflect.String {
+				dst.SetString(rv.String())
+				return nil
+			}
+		}
+	case reflect.Bool:
+		if b, ok := src.(bool); ok {
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := src.(*big.Int); ok {
+			if !n.IsInt64() || dst.OverflowInt(n.Int64()) {
+				return fmt.Errorf("%s overflows %s", n, t)
+			}
+			dst.SetInt(n.Int64())
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := src.(*big.Int); ok {
+			if !n.IsUint64() || dst.OverflowUint(n.Uint64()) {
+				return fmt.Errorf("%s overflows %s", n, t)
+			}
+			dst.SetUint(n.Uint64())
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := src.(type) {
+		case *big.Int:
+			f, _ := new(big.Float).SetInt(n).Float64()
+			dst.SetFloat(f)
+			return nil
+		case Decimal:
+			f, err := strconv.ParseFloat(string(n), 64)
+			if err != nil {
+				return err
+			}
+			dst.SetFloat(f)
+			return nil
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if b, ok := hexValue(src); ok {
+				dst.SetBytes(b)
+				return nil
+			}
+			break
+		}
+		if list, ok := src.([]interface{}); ok {
+			out := reflect.MakeSlice(t, len(list), len(list))
+			for i, elem := range list {
+				if err := assign(out.Index(i), elem); err != nil {
+					return fmt.Errorf("[%d]: %w", i, err)
+				}
+			}
+			dst.Set(out)
+			return nil
+		}
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if b, ok := hexValue(src); ok && len(b) <= t.Len() {
+				reflect.Copy(dst, reflect.ValueOf(b))
+				return nil
+			}
+			break
+		}
+		if list, ok := src.([]interface{}); ok && len(list) == t.Len() {
+			for i, elem := range list {
+				if err := assign(dst.Index(i), elem); err != nil {
+					return fmt.Errorf("[%d]: %w", i, err)
+				}
+			}
+			return nil
+		}
+	case reflect.Struct:
+		if tuple, ok := src.(map[string]interface{}); ok {
+			return decodeStruct(dst, tuple)
+		}
+	}
+	return fmt.Errorf("cannot decode %T into %s", src, t)
+}
+
+// hexValue decodes the 0x-prefixed hex strings used for bytes values.
+func hexValue(src interface{}) ([]byte, bool) {
+	s, ok := src.(string)
+	if !ok {
+		return nil, false
+	}
+	b, err := hexutil.Decode(s)
+	return b, err == nil
+}
@@ -0,0 +1,200 @@
+package subsrciber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/naman1402/geth-indexer/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transaction holds the fields of the transaction and receipt that logged an event.
+type Transaction struct {
+	Hash        common.Hash
+	BlockNumber uint64
+	From        common.Address
+	// To is nil for contract creations.
+	To    *common.Address
+	Nonce uint64
+	// Value is the amount of wei sent.
+	Value *big.Int
+	// Input is the calldata of the transaction.
+	Input []byte
+	// GasPrice is the gasPrice returned by the node: the price of legacy transactions and,
+	// for mined EIP-1559 ones, the price actually paid.
+	GasPrice *big.Int
+	// MaxFeePerGas is the fee cap of EIP-1559 transactions, nil for legacy ones.
+	MaxFeePerGas *big.Int
+	// EffectiveGasPrice is the price per gas actually paid, from the receipt.
+	EffectiveGasPrice *big.Int
+	GasUsed           uint64
+	// Status is 1 for a successful transaction and 0 for a reverted one.
+	Status uint64
+	// Call is the decoded calldata when the transaction calls the indexed contract directly,
+	// set by the CallScanner and, on events, by an Enricher decoding calls.
+	Call *Call
+}
+
+// rpcTransaction and rpcReceipt are the fields read from eth_getTransactionByHash and
+// eth_getTransactionReceipt.
+type rpcTransaction struct {
+	Hash        common.Hash     `json:"hash"`
+	BlockNumber *hexutil.Big    `json:"blockNumber"`
+	From        common.Address  `json:"from"`
+	To          *common.Address `json:"to"`
+	Nonce       hexutil.Uint64  `json:"nonce"`
+	Value       *hexutil.Big    `json:"value"`
+	Input       hexutil.Bytes   `json:"input"`
+	GasPrice    *hexutil.Big    `json:"gasPrice"`
+	MaxFee      *hexutil.Big    `json:"maxFeePerGas"`
+}
+
+type rpcReceipt struct {
+	GasUsed           hexutil.Uint64 `json:"gasUsed"`
+	EffectiveGasPrice *hexutil.Big   `json:"effectiveGasPrice"`
+	Status            hexutil.Uint64 `json:"status"`
+}
+
+// Enricher sets Event.Tx from the transactions and receipts fetched from the node in batched
+// JSON-RPC calls. Fetched transactions are cached by hash, so the events of one transaction
+// cost a single lookup.
+type Enricher struct {
+	client *rpc.Client
+	// contract decodes the calldata of transactions sent to it, nil to skip calls
+	contract  *Contract
+	batchSize int
+	cache     *lru.Cache[common.Hash, *Transaction]
+}
+
+// NewEnricher returns an Enricher fetching up to batchSize transactions per call and caching
+// the last cacheSize ones. When c is not nil, the calldata of transactions calling c is
+// decoded into Transaction.Call.
+func NewEnricher(client *rpc.Client, c *Contract, batchSize, cacheSize int) *Enricher {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	if cacheSize <= 0 {
+		cacheSize = 1
+	}
+	return &Enricher{client: client, contract: c, batchSize: batchSize, cache: lru.NewCache[common.Hash, *Transaction](cacheSize)}
+}
+
+// Enrich sets Tx on every event, fetching the transactions missing from the cache. Events
+// whose transaction the node does not know, e.g. on a pruned node or after a reorg, are
+// logged and keep a nil Tx. It only fails when the node cannot be reached.
+func (en *Enricher) Enrich(ctx context.Context, events []*Event) error {
+	fetched := make(map[common.Hash]*Transaction)
+	var missing []common.Hash
+	for _, e := range events {
+		if tx, ok := en.cache.Get(e.TxnHash); ok {
+			e.Tx = tx
+			continue
+		}
+		if _, ok := fetched[e.TxnHash]; !ok {
+			fetched[e.TxnHash] = nil
+			missing = append(missing, e.TxnHash)
+		}
+	}
+
+	for start := 0; start < len(missing); start += en.batchSize {
+		batch := missing[start:min(start+en.batchSize, len(missing))]
+		txs, err := en.fetch(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for _, tx := range txs {
+			fetched[tx.Hash] = tx
+			en.cache.Add(tx.Hash, tx)
+		}
+	}
+	for _, e := range events {
+		if e.Tx == nil {
+			e.Tx = fetched[e.TxnHash]
+		}
+	}
+	return nil
+}
+
+// fetch gets the transactions and receipts of hashes in one batch call. Transactions the
+// node fails to return are logged and left out.
+func (en *Enricher) fetch(ctx context.Context, hashes []common.Hash) ([]*Transaction, error) {
+	ctx, span := tracer.Start(ctx, "subscriber.enrich", trace.WithAttributes(attribute.Int("transactions", len(hashes))))
+	defer span.End()
+
+	txs := make([]*rpcTransaction, len(hashes))
+	receipts := make([]*rpcReceipt, len(hashes))
+	batch := make([]rpc.BatchElem, 0, 2*len(hashes))
+	for i, hash := range hashes {
+		batch = append(batch,
+			rpc.BatchElem{Method: "eth_getTransactionByHash", Args: []interface{}{hash}, Result: &txs[i]},
+			rpc.BatchElem{Method: "eth_getTransactionReceipt", Args: []interface{}{hash}, Result: &receipts[i]})
+	}
+	if err := en.client.BatchCallContext(ctx, batch); err != nil {
+		metrics.ObserveRPC("eth_getTransactionByHash", err)
+		recordSpanError(span, err)
+		return nil, fmt.Errorf("failed to fetch transactions: %w", err)
+	}
+
+	out := make([]*Transaction, 0, len(hashes))
+	for i, hash := range hashes {
+		txElem, receiptElem := batch[2*i], batch[2*i+1]
+		metrics.ObserveRPC(txElem.Method, txElem.Error)
+		metrics.ObserveRPC(receiptElem.Method, receiptElem.Error)
+		err := errors.Join(txElem.Error, receiptElem.Error)
+		if err == nil && (txs[i] == nil || receipts[i] == nil) {
+			err = errors.New("transaction not found")
+		}
+		if err != nil {
+			recordSpanError(span, err)
+			logger.Warn("failed to fetch transaction, storing its events without it", "txn", hash.Hex(), "err", err)
+			continue
+		}
+		tx := newTransaction(hash, txs[i], receipts[i])
+		if en.contract != nil && tx.To != nil && *tx.To == en.contract.Address {
+			call, err := en.contract.DecodeCall(tx.BlockNumber, tx.Input)
+			if err != nil {
+				logger.Warn("failed to decode calldata", "txn", hash.Hex(), "selector", call.Selector, "err", err)
+			}
+			tx.Call = call
+		}
+		out = append(out, tx)
+	}
+	return out, nil
+}
+
+// newTransaction merges a transaction and its receipt.
+func newTransaction(hash common.Hash, tx *rpcTransaction, receipt *rpcReceipt) *Transaction {
+	t := &Transaction{
+		Hash:    hash,
+		From:    tx.From,
+		To:      tx.To,
+		Nonce:   uint64(tx.Nonce),
+		Value:   new(big.Int),
+		Input:   tx.Input,
+		GasUsed: uint64(receipt.GasUsed),
+		Status:  uint64(receipt.Status),
+	}
+	if tx.Value != nil {
+		t.Value = tx.Value.ToInt()
+	}
+	if tx.BlockNumber != nil {
+		t.BlockNumber = tx.BlockNumber.ToInt().Uint64()
+	}
+	if tx.GasPrice != nil {
+		t.GasPrice = tx.GasPrice.ToInt()
+	}
+	if tx.MaxFee != nil {
+		t.MaxFeePerGas = tx.MaxFee.ToInt()
+	}
+	if receipt.EffectiveGasPrice != nil {
+		t.EffectiveGasPrice = receipt.EffectiveGasPrice.ToInt()
+	}
+	return t
+}
@@ -0,0 +1,129 @@
+package subsrciber
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	errNoAnonymousMatch   = errors.New("no anonymous event matches the log")
+	errAmbiguousAnonymous = errors.New("several anonymous events match the log")
+)
+
+// eventTopics maps the topic0 of every non-anonymous event of a to its ABI name. Anonymous
+// events emit no topic0 and are matched by matchAnonymous instead.
+func eventTopics(a abi.ABI) map[common.Hash]string {
+	topics := make(map[common.Hash]string, len(a.Events))
+	for _, e := range a.Events {
+		if !e.Anonymous {
+			topics[e.ID] = e.Name
+		}
+	}
+	return topics
+}
+
+// EventRequested reports whether e is selected by one of the requested events. An event is
+// selected by its ABI name ("Transfer0" for the second overload of Transfer), by its source
+// name ("Transfer", selecting every overload) or by its full signature
+// ("Transfer(address,address,uint256)", spaces are ignored).
+func EventRequested(events []string, e abi.Event) bool {
+	for _, req := range events {
+		if strings.Contains(req, "(") {
+			if strings.ReplaceAll(req, " ", "") == e.Sig {
+				return true
+			}
+			continue
+		}
+		if req == e.Name || req == e.RawName {
+			return true
+		}
+	}
+	return false
+}
+
+// ArgumentName returns the name of the i-th event argument, "arg<i>" when the ABI leaves it
+// unnamed. It is the key of the argument in Event.Data and its column name.
+func ArgumentName(arg abi.Argument, i int) string {
+	if arg.Name == "" {
+		return fmt.Sprintf("arg%d", i)
+	}
+	return arg.Name
+}
+
+// indexedCount returns the number of indexed arguments of e.
+func indexedCount(e abi.Event) int {
+	n := 0
+	for _, in := range e.Inputs {
+		if in.Indexed {
+			n++
+		}
+	}
+	return n
+}
+
+// matchAnonymous finds the requested anonymous event of contractABI that log is an instance
+// of. The log was emitted by the contract, so a candidate must have one indexed argument per
+// topic and its data must re-encode to exactly log.Data. It returns the event and the decoded
+// values, and fails when no event or more than one matches.
+func matchAnonymous(ctx context.Context, events []string, log types.Log, contractABI abi.ABI) (abi.Event, map[string]interface{}, error) {
+	names := make([]string, 0, len(contractABI.Events))
+	for name := range contractABI.Events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		matched []abi.Event
+		decoded map[string]interface{}
+	)
+	for _, name := range names {
+		e := contractABI.Events[name]
+		if !e.Anonymous || indexedCount(e) != len(log.Topics) || !EventRequested(events, e) {
+			continue
+		}
+		if !sameLayout(e, log.Data) {
+			continue
+		}
+		data, err := unpackLog(ctx, e.Name, log.Topics, log.Data, contractABI)
+		if err != nil {
+			continue
+		}
+		matched = append(matched, e)
+		decoded = data
+	}
+
+	switch len(matched) {
+	case 0:
+		return abi.Event{}, nil, errNoAnonymousMatch
+	case 1:
+		return matched[0], decoded, nil
+	default:
+		sigs := make([]string, 0, len(matched))
+		for _, e := range matched {
+			sigs = append(sigs, e.Sig)
+		}
+		return abi.Event{}, nil, fmt.Errorf("%w: %s", errAmbiguousAnonymous, strings.Join(sigs, ", "))
+	}
+}
+
+// sameLayout reports whether data is exactly the ABI encoding of the non-indexed arguments of e.
+func sameLayout(e abi.Event, data []byte) bool {
+	args := e.Inputs.NonIndexed()
+	if len(args) == 0 {
+		return len(data) == 0
+	}
+	values, err := args.Unpack(data)
+	if err != nil {
+		return false
+	}
+	packed, err := args.Pack(values...)
+	return err == nil && bytes.Equal(packed, data)
+}
@@ -0,0 +1,76 @@
+package subsrciber
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// anonymousABI has anonymous events sharing a layout (Deposit, Withdrawal), differing only by
+// the data (Memo) or by the topic count (Moved), and a named event with the layout of Deposit.
+const anonymousABI = `[
+	{"type":"event","name":"Deposit","anonymous":true,"inputs":[{"name":"who","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Withdrawal","anonymous":true,"inputs":[{"name":"who","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Memo","anonymous":true,"inputs":[{"name":"who","type":"address","indexed":true},{"name":"text","type":"string","indexed":false}]},
+	{"type":"event","name":"Moved","anonymous":true,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Minted","anonymous":false,"inputs":[{"name":"who","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false}]}
+]`
+
+func TestMatchAnonymous(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(anonymousABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	who := common.HexToAddress("0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc")
+	whoTopic := common.BytesToHash(who.Bytes())
+	amount := common.BigToHash(big.NewInt(1e18)).Bytes()
+	memo, err := parsed.Events["Memo"].Inputs.NonIndexed().Pack("gm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		events []string
+		topics []common.Hash
+		data   []byte
+		want   string // the matched event, or the error
+	}{
+		{"one requested candidate", []string{"Deposit", "Memo", "Moved"}, []common.Hash{whoTopic}, amount, "Deposit"},
+		{"candidates sharing a layout are ambiguous", []string{"Deposit", "Withdrawal"}, []common.Hash{whoTopic}, amount,
+			"several anonymous events match the log: Deposit(address,uint256), Withdrawal(address,uint256)"},
+		{"data telling candidates apart", []string{"Deposit", "Withdrawal", "Memo"}, []common.Hash{whoTopic}, memo, "Memo"},
+		{"topic count telling candidates apart", []string{"Deposit", "Moved"}, []common.Hash{whoTopic, whoTopic}, amount, "Moved"},
+		{"trailing data", []string{"Deposit"}, []common.Hash{whoTopic}, append(amount, make([]byte, 32)...), errNoAnonymousMatch.Error()},
+		{"no requested candidate", []string{"Withdrawal"}, []common.Hash{whoTopic}, memo, errNoAnonymousMatch.Error()},
+		{"named events are not candidates", []string{"Minted"}, []common.Hash{whoTopic}, amount, errNoAnonymousMatch.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e, data, err := matchAnonymous(context.Background(), tc.events, types.Log{Topics: tc.topics, Data: tc.data}, parsed)
+			if err != nil {
+				if err.Error() != tc.want {
+					t.Errorf("got error %q, want %q", err, tc.want)
+				}
+				if !errors.Is(err, errNoAnonymousMatch) && !errors.Is(err, errAmbiguousAnonymous) {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if e.Name != tc.want {
+				t.Fatalf("matched %s, want %s", e.Name, tc.want)
+			}
+			if data["who"] != nil && data["who"] != who.Hex() {
+				t.Errorf("who: got %v", data["who"])
+			}
+			if len(data) != len(e.Inputs) {
+				t.Errorf("got values %v, want one per input of %s", data, e.Sig)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package subsrciber
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// topicFilter restricts an indexed argument of an event to a set of values, e.g.
+// "Transfer.to in [0xabc..., 0xdef...]". Filters are encoded into the eth_getLogs topics
+// so non-matching logs are never fetched.
+type topicFilter struct {
+	// event selects events like the requested event names: ABI name, source name or signature.
+	event  string
+	arg    string
+	values []string
+}
+
+func (f topicFilter) String() string {
+	return fmt.Sprintf("%s.%s", f.event, f.arg)
+}
+
+// parseTopicFilters parses filters written as "Event.arg in [v1, v2]" or "Event.arg = v".
+func parseTopicFilters(specs []string) ([]topicFilter, error) {
+	var filters []topicFilter
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		left, right, ok := strings.Cut(spec, " in ")
+		if !ok {
+			left, right, ok = strings.Cut(spec, "=")
+			right = strings.TrimPrefix(right, "=")
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid filter %q, expected Event.arg in [values] or Event.arg = value", spec)
+		}
+		left = strings.TrimSpace(left)
+		dot := strings.LastIndex(left, ".")
+		if dot <= 0 || dot == len(left)-1 {
+			return nil, fmt.Errorf("invalid filter %q, expected Event.arg on the left side", spec)
+		}
+
+		right = strings.TrimSpace(right)
+		if strings.HasPrefix(right, "[") && strings.HasSuffix(right, "]") {
+			right = right[1 : len(right)-1]
+		}
+		var values []string
+		for _, v := range strings.Split(right, ",") {
+			v = strings.Trim(strings.TrimSpace(v), `"'`)
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("invalid filter %q, no values", spec)
+		}
+		filters = append(filters, topicFilter{
+			event:  strings.TrimSpace(left[:dot]),
+			arg:    strings.TrimSpace(left[dot+1:]),
+			values: values,
+		})
+	}
+	return filters, nil
+}
+
+// topicsOf returns the topic position of the filtered argument in the logs of e and the
+// accepted topic values. ok is false when e has no indexed argument of that name.
+func (f topicFilter) topicsOf(e abi.Event) (pos int, hashes []common.Hash, ok bool, err error) {
+	pos = 1
+	if e.Anonymous {
+		pos = 0
+	}
+	var arg abi.Argument
+	for i, in := range e.Inputs {
+		if !in.Indexed {
+			continue
+		}
+		if ArgumentName(in, i) == f.arg {
+			arg, ok = in, true
+			break
+		}
+		pos++
+	}
+	if !ok {
+		return 0, nil, false, nil
+	}
+	for _, v := range f.values {
+		h, err := encodeTopic(arg.Type, v)
+		if err != nil {
+			return 0, nil, false, fmt.Errorf("filter %s: %w", f, err)
+		}
+		hashes = append(hashes, h)
+	}
+	return pos, hashes, true, nil
+}
+
+// encodeTopic encodes a filter value the way an indexed argument of type t is stored in a
+// topic: value types are left-padded (fixed bytes right-padded), strings and bytes are hashed.
+func encodeTopic(t abi.Type, v string) (common.Hash, error) {
+	switch t.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(v) {
+			return common.Hash{}, fmt.Errorf("invalid address %q", v)
+		}
+		return common.BytesToHash(common.HexToAddress(v).Bytes()), nil
+	case abi.IntTy, abi.UintTy:
+		n, ok := new(big.Int).SetString(v, 0)
+		if !ok {
+			return common.Hash{}, fmt.Errorf("invalid integer %q", v)
+		}
+		// negative values are stored in two's complement
+		return common.BytesToHash(math.U256Bytes(n)), nil
+	case abi.BoolTy:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("invalid bool %q", v)
+		}
+		if b {
+			return common.BigToHash(big.NewInt(1)), nil
+		}
+		return common.Hash{}, nil
+	case abi.FixedBytesTy:
+		b, err := hexutil.Decode(v)
+		if err != nil || len(b) > t.Size {
+			return common.Hash{}, fmt.Errorf("invalid %s %q", t, v)
+		}
+		var h common.Hash
+		copy(h[:], b)
+		return h, nil
+	case abi.StringTy:
+		return crypto.Keccak256Hash([]byte(v)), nil
+	case abi.BytesTy:
+		b, err := hexutil.Decode(v)
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("invalid bytes %q", v)
+		}
+		return crypto.Keccak256Hash(b), nil
+	}
+	return common.Hash{}, fmt.Errorf("filters on %s arguments are not supported", t)
+}
+
+// requestedEvents returns every requested event c can decode: the events of each ABI in the
+// proxy timeline and, with the signature fallback, the matching registry events.
+func (c *Contract) requestedEvents(events []string) []abi.Event {
+	abis := []abi.ABI{c.ABI}
+	for _, v := range c.history {
+		abis = append(abis, v.abi)
+	}
+	var out []abi.Event
+	for _, a := range abis {
+		for _, e := range sortedEvents(a) {
+			if EventRequested(events, e) {
+				out = append(out, e)
+			}
+		}
+	}
+	if c.fallback {
+		var matched []abi.Event
+		for _, entry := range registry {
+			if e := entry.abi.Events[entry.name]; EventRequested(events, e) {
+				matched = append(matched, e)
+			}
+		}
+		// registry order is random, keep the topics stable across runs
+		sort.Slice(matched, func(i, j int) bool {
+			return matched[i].String() < matched[j].String()
+		})
+		out = append(out, matched...)
+	}
+	return out
+}
+
+// constraints returns the accepted values per topic position of e under the topic filters.
+// Several filters on the same argument must all hold. ok is false when no log of e can pass
+// the filters: a filter names an argument e does not index, or the filters exclude each other.
+func (c *Contract) constraints(e abi.Event) (map[int][]common.Hash, bool, error) {
+	out := make(map[int][]common.Hash)
+	for _, f := range c.filters {
+		if !EventRequested([]string{f.event}, e) {
+			continue
+		}
+		pos, hashes, ok, err := f.topicsOf(e)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		if prev, seen := out[pos]; seen {
+			hashes = intersect(prev, hashes)
+		}
+		if len(hashes) == 0 {
+			return nil, false, nil
+		}
+		out[pos] = hashes
+	}
+	return out, true, nil
+}
+
+// filterTopics returns the eth_getLogs topics selecting the requested events with the topic
+// filters applied. A position is only narrowed when every requested event is filtered on it,
+// logs of other events would be lost otherwise; passesFilters drops the remaining misses.
+// It returns nil topics when logs cannot be selected by topic0 (anonymous events).
+func (c *Contract) filterTopics(events []string) ([][]common.Hash, error) {
+	candidates := c.requestedEvents(events)
+	for _, f := range c.filters {
+		matched, indexed := false, false
+		for _, e := range candidates {
+			if !EventRequested([]string{f.event}, e) {
+				continue
+			}
+			matched = true
+			_, _, ok, err := f.topicsOf(e)
+			if err != nil {
+				return nil, err
+			}
+			indexed = indexed || ok
+		}
+		switch {
+		case !matched:
+			return nil, fmt.Errorf("filter %s: event %s is not requested", f, f.event)
+		case !indexed:
+			return nil, fmt.Errorf("filter %s: %s is not an indexed argument of %s", f, f.arg, f.event)
+		}
+	}
+	if len(candidates) == 0 || c.requestsAnonymous(events) {
+		return nil, nil
+	}
+
+	var (
+		topic0 []common.Hash
+		kept   []map[int][]common.Hash
+		seen   = make(map[common.Hash]bool)
+	)
+	for _, e := range candidates {
+		cons, ok, err := c.constraints(e)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		kept = append(kept, cons)
+		if !seen[e.ID] {
+			seen[e.ID] = true
+			topic0 = append(topic0, e.ID)
+		}
+	}
+	if len(topic0) == 0 {
+		return nil, fmt.Errorf("topic filters exclude every requested event")
+	}
+
+	topics := [][]common.Hash{topic0}
+	for pos := 1; pos < 4; pos++ {
+		var values []common.Hash
+		for _, cons := range kept {
+			hashes, ok := cons[pos]
+			if !ok {
+				values = nil
+				break
+			}
+			values = union(values, hashes)
+		}
+		topics = append(topics, values)
+	}
+	for len(topics) > 1 && topics[len(topics)-1] == nil {
+		topics = topics[:len(topics)-1]
+	}
+	return topics, nil
+}
+
+// passesFilters reports whether a log of e with the given topics satisfies the topic filters.
+func (c *Contract) passesFilters(e abi.Event, topics []common.Hash) bool {
+	cons, ok, err := c.constraints(e)
+	if err != nil || !ok {
+		return false
+	}
+	for pos, hashes := range cons {
+		if pos >= len(topics) || !containsHash(hashes, topics[pos]) {
+			return false
+		}
+	}
+	return true
+}
+
+// logTopics returns the topics of the historical eth_getLogs queries: the topic0 of every
+// known event, narrowed by the topic filters when there are any.
+func (c *Contract) logTopics(events []string) ([][]common.Hash, error) {
+	if len(c.filters) > 0 {
+		return c.filterTopics(events)
+	}
+	if t := c.historicalTopics(events); t != nil {
+		return [][]common.Hash{t}, nil
+	}
+	return nil, nil
+}
+
+func containsHash(hashes []common.Hash, h common.Hash) bool {
+	for _, x := range hashes {
+		if x == h {
+			return true
+		}
+	}
+	return false
+}
+
+func intersect(a, b []common.Hash) []common.Hash {
+	var out []common.Hash
+	for _, h := range a {
+		if containsHash(b, h) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func union(a, b []common.Hash) []common.Hash {
+	for _, h := range b {
+		if !containsHash(a, h) {
+			a = append(a, h)
+		}
+	}
+	return a
+}
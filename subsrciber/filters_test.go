@@ -0,0 +1,252 @@
+package subsrciber
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const filterABI = `[
+	{"type":"event","name":"Transfer","anonymous":false,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Approval","anonymous":false,"inputs":[{"name":"owner","type":"address","indexed":true},{"name":"spender","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Rebased","anonymous":false,"inputs":[{"name":"delta","type":"int256","indexed":true},{"name":"memo","type":"string","indexed":true}]},
+	{"type":"event","name":"Memo","anonymous":true,"inputs":[{"name":"who","type":"address","indexed":true},{"name":"text","type":"string","indexed":false}]}
+]`
+
+func TestEncodeTopic(t *testing.T) {
+	holder := common.HexToAddress("0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc")
+	for _, tc := range []struct {
+		typ   string
+		value string
+		want  string // the topic, or the error
+	}{
+		{"address", "0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc", common.BytesToHash(holder.Bytes()).Hex()},
+		{"address", "0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc", common.BytesToHash(holder.Bytes()).Hex()},
+		{"address", "0xb4e16d", `invalid address "0xb4e16d"`},
+		{"uint256", "1000000000000000000", common.BigToHash(big.NewInt(1e18)).Hex()},
+		{"uint256", "0x10", common.BigToHash(big.NewInt(16)).Hex()},
+		{"uint256", "1e18", `invalid integer "1e18"`},
+		{"int256", "-1", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		{"int8", "-2", "0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"},
+		{"bool", "true", common.BigToHash(big.NewInt(1)).Hex()},
+		{"bool", "false", common.Hash{}.Hex()},
+		{"bool", "yes", `invalid bool "yes"`},
+		{"bytes4", "0xa9059cbb", "0xa9059cbb00000000000000000000000000000000000000000000000000000000"},
+		{"bytes4", "0xa9059cbb00", `invalid bytes4 "0xa9059cbb00"`},
+		{"bytes32", crypto.Keccak256Hash([]byte("x")).Hex(), crypto.Keccak256Hash([]byte("x")).Hex()},
+		{"string", "hello", crypto.Keccak256Hash([]byte("hello")).Hex()},
+		{"bytes", "0xdeadbeef", crypto.Keccak256Hash([]byte{0xde, 0xad, 0xbe, 0xef}).Hex()},
+		{"bytes", "deadbeef", `invalid bytes "deadbeef"`},
+		{"uint256[]", "1", "filters on uint256[] arguments are not supported"},
+	} {
+		t.Run(tc.typ+" "+tc.value, func(t *testing.T) {
+			got, err := encodeTopic(newType(t, tc.typ), tc.value)
+			if err != nil {
+				if err.Error() != tc.want {
+					t.Errorf("got error %q, want %q", err, tc.want)
+				}
+				return
+			}
+			if got.Hex() != tc.want {
+				t.Errorf("got %s, want %s", got.Hex(), tc.want)
+			}
+			// value types decode back to the filter value
+			arg := abi.Argument{Type: newType(t, tc.typ), Indexed: true}
+			if arg.Type.T == abi.StringTy || arg.Type.T == abi.BytesTy {
+				return
+			}
+			decoded, err := decodeTopic(arg, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if back, err := encodeTopic(arg.Type, fmt.Sprint(decoded)); err != nil || back != got {
+				t.Errorf("decoded %v encodes to %s, %v", decoded, back.Hex(), err)
+			}
+		})
+	}
+}
+
+func TestParseTopicFilters(t *testing.T) {
+	filters, err := parseTopicFilters([]string{
+		"Transfer.to in [0xa, 0xb]",
+		`Approval.owner == "0xc"`,
+		" Transfer(address,address,uint256).from = 0xd ",
+		"",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []topicFilter{
+		{event: "Transfer", arg: "to", values: []string{"0xa", "0xb"}},
+		{event: "Approval", arg: "owner", values: []string{"0xc"}},
+		{event: "Transfer(address,address,uint256)", arg: "from", values: []string{"0xd"}},
+	}
+	if !reflect.DeepEqual(filters, want) {
+		t.Errorf("got %+v, want %+v", filters, want)
+	}
+
+	for _, spec := range []string{"Transfer.to", "to = 0xa", "Transfer. = 0xa", "Transfer.to in []"} {
+		if _, err := parseTopicFilters([]string{spec}); err == nil {
+			t.Errorf("%q: want an error", spec)
+		}
+	}
+}
+
+func TestFilterTopics(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(filterABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer, approval, rebased := parsed.Events["Transfer"].ID, parsed.Events["Approval"].ID, parsed.Events["Rebased"].ID
+	a := common.HexToAddress("0x000000000000000000000000000000000000000a")
+	b := common.HexToAddress("0x000000000000000000000000000000000000000b")
+	ta, tb := common.BytesToHash(a.Bytes()), common.BytesToHash(b.Bytes())
+
+	for _, tc := range []struct {
+		name    string
+		events  []string
+		filters []string
+		want    [][]common.Hash
+		err     string
+	}{
+		{
+			name:    "one value",
+			events:  []string{"Transfer"},
+			filters: []string{"Transfer.to = " + a.Hex()},
+			want:    [][]common.Hash{{transfer}, nil, {ta}},
+		},
+		{
+			name:    "OR-set",
+			events:  []string{"Transfer"},
+			filters: []string{"Transfer.from in [" + a.Hex() + ", " + b.Hex() + "]"},
+			want:    [][]common.Hash{{transfer}, {ta, tb}},
+		},
+		{
+			name:    "filters on the same argument must all hold",
+			events:  []string{"Transfer"},
+			filters: []string{"Transfer.to in [" + a.Hex() + ", " + b.Hex() + "]", "Transfer.to = " + b.Hex()},
+			want:    [][]common.Hash{{transfer}, nil, {tb}},
+		},
+		{
+			name:    "an unfiltered event keeps the position open",
+			events:  []string{"Transfer", "Approval"},
+			filters: []string{"Transfer.from = " + a.Hex()},
+			want:    [][]common.Hash{{approval, transfer}},
+		},
+		{
+			name:    "every event filtered on a position",
+			events:  []string{"Transfer", "Approval"},
+			filters: []string{"Transfer.from = " + a.Hex(), "Approval.owner = " + b.Hex()},
+			want:    [][]common.Hash{{approval, transfer}, {tb, ta}},
+		},
+		{
+			name:    "filter by signature",
+			events:  []string{"Transfer"},
+			filters: []string{"Transfer(address,address,uint256).to = " + a.Hex()},
+			want:    [][]common.Hash{{transfer}, nil, {ta}},
+		},
+		{
+			name:    "negative integer and hashed string",
+			events:  []string{"Rebased"},
+			filters: []string{"Rebased.delta = -1", "Rebased.memo = hello"},
+			want: [][]common.Hash{{rebased},
+				{common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")},
+				{crypto.Keccak256Hash([]byte("hello"))}},
+		},
+		{
+			name:    "filters excluding each other",
+			events:  []string{"Transfer"},
+			filters: []string{"Transfer.to = " + a.Hex(), "Transfer.to = " + b.Hex()},
+			err:     "topic filters exclude every requested event",
+		},
+		{
+			name:    "unknown argument",
+			events:  []string{"Transfer"},
+			filters: []string{"Transfer.amount = 1"},
+			err:     "filter Transfer.amount: amount is not an indexed argument of Transfer",
+		},
+		{
+			name:    "non-indexed argument",
+			events:  []string{"Transfer"},
+			filters: []string{"Transfer.value = 1"},
+			err:     "filter Transfer.value: value is not an indexed argument of Transfer",
+		},
+		{
+			name:    "event not requested",
+			events:  []string{"Transfer"},
+			filters: []string{"Approval.owner = " + a.Hex()},
+			err:     "filter Approval.owner: event Approval is not requested",
+		},
+		{
+			name:    "invalid value",
+			events:  []string{"Transfer"},
+			filters: []string{"Transfer.to = 0xzz"},
+			err:     `filter Transfer.to: invalid address "0xzz"`,
+		},
+		{
+			name:    "anonymous events are not selected by topic",
+			events:  []string{"Transfer", "Memo"},
+			filters: []string{"Transfer.to = " + a.Hex()},
+			want:    nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filters, err := parseTopicFilters(tc.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &Contract{ABI: parsed, filters: filters}
+			got, err := c.filterTopics(tc.events)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPassesFilters(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(filterABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := common.HexToAddress("0x000000000000000000000000000000000000000a")
+	a := common.BytesToHash(from.Bytes())
+	b := common.BytesToHash(common.HexToAddress("0x000000000000000000000000000000000000000b").Bytes())
+	filters, err := parseTopicFilters([]string{"Transfer.from = " + from.Hex()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// filterTopics leaves Transfer.from open when Approval is requested too
+	c := &Contract{ABI: parsed, filters: filters}
+	transfer, approval := parsed.Events["Transfer"], parsed.Events["Approval"]
+
+	for _, tc := range []struct {
+		e      abi.Event
+		topics []common.Hash
+		want   bool
+	}{
+		{transfer, []common.Hash{transfer.ID, a, b}, true},
+		{transfer, []common.Hash{transfer.ID, b, a}, false},
+		{transfer, []common.Hash{transfer.ID}, false},
+		{approval, []common.Hash{approval.ID, b, b}, true},
+	} {
+		if got := c.passesFilters(tc.e, tc.topics); got != tc.want {
+			t.Errorf("%s %v: got %t, want %t", tc.e.Name, tc.topics, got, tc.want)
+		}
+	}
+}
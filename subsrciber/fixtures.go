@@ -0,0 +1,242 @@
+package subsrciber
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+// Trace fixtures are JSON files holding JSON-RPC exchanges with a node: the tracer can record
+// them from a live node (TRACE_RECORD) and replay them without one (TRACE_FIXTURES), which
+// makes tracing reproducible in tests and demos. The traces_*.json fixtures in testdata are
+// hand-written in the geth and Parity formats, recorded_*.json ones are recorded from mainnet,
+// and traces_test.go replays both.
+//
+//	[{"method": "trace_filter", "params": [...], "result": [...]}, ...]
+
+// fixtureExchange is a JSON-RPC call and its result or error.
+type fixtureExchange struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *fixtureError   `json:"error,omitempty"`
+}
+
+type fixtureError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// jsonrpcMessage is a JSON-RPC request or response.
+type jsonrpcMessage struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *fixtureError   `json:"error,omitempty"`
+}
+
+// DialTracer connects the CallTracer client: to the fixtures of opts.Traces.Fixtures when
+// set, otherwise to the node, recording the exchanges to opts.Traces.Record when set.
+func DialTracer(ctx context.Context, opts *cli.Config) (*rpc.Client, error) {
+	if opts.Traces.Fixtures != "" {
+		exchanges, err := readFixtures(opts.Traces.Fixtures)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("replaying trace fixtures", "file", opts.Traces.Fixtures, "exchanges", len(exchanges))
+		return rpc.DialOptions(ctx, "http://fixtures", rpc.WithHTTPClient(&http.Client{Transport: &replayTransport{exchanges: exchanges}}))
+	}
+	if opts.Traces.Record == "" {
+		return rpc.DialContext(ctx, opts.API.EthNodeURL)
+	}
+	if !strings.HasPrefix(opts.API.EthNodeURL, "http://") && !strings.HasPrefix(opts.API.EthNodeURL, "https://") {
+		return nil, errors.New("recording trace fixtures needs an http(s) RPC URL")
+	}
+	logger.Info("recording trace fixtures", "file", opts.Traces.Record)
+	rec := &recordTransport{base: http.DefaultTransport, path: opts.Traces.Record}
+	return rpc.DialOptions(ctx, opts.API.EthNodeURL, rpc.WithHTTPClient(&http.Client{Transport: rec}))
+}
+
+func readFixtures(path string) ([]fixtureExchange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace fixtures: %w", err)
+	}
+	var exchanges []fixtureExchange
+	if err := json.Unmarshal(data, &exchanges); err != nil {
+		return nil, fmt.Errorf("invalid trace fixtures %s: %w", path, err)
+	}
+	return exchanges, nil
+}
+
+// parseMessages parses a single JSON-RPC message or a batch.
+func parseMessages(body []byte) ([]jsonrpcMessage, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var msgs []jsonrpcMessage
+		err := json.Unmarshal(body, &msgs)
+		return msgs, true, err
+	}
+	var msg jsonrpcMessage
+	err := json.Unmarshal(body, &msg)
+	return []jsonrpcMessage{msg}, false, err
+}
+
+// replayTransport answers JSON-RPC requests from fixtures, matching the method and params.
+type replayTransport struct {
+	exchanges []fixtureExchange
+}
+
+func (rt *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	msgs, batch, err := parseMessages(body)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]jsonrpcMessage, len(msgs))
+	for i, msg := range msgs {
+		responses[i] = jsonrpcMessage{Version: "2.0", ID: msg.ID}
+		ex := rt.find(msg.Method, msg.Params)
+		switch {
+		case ex == nil:
+			responses[i].Error = &fixtureError{Code: -32601, Message: fmt.Sprintf("no fixture for %s %s", msg.Method, msg.Params)}
+		case ex.Error != nil:
+			responses[i].Error = ex.Error
+		case ex.Result == nil:
+			responses[i].Result = json.RawMessage("null")
+		default:
+			responses[i].Result = ex.Result
+		}
+	}
+
+	var out interface{} = responses
+	if !batch {
+		out = responses[0]
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// find returns the first exchange of method whose params are equal to params as JSON values,
+// so formatting and key order do not matter.
+func (rt *replayTransport) find(method string, params json.RawMessage) *fixtureExchange {
+	want, err := paramsValue(params)
+	if err != nil {
+		return nil
+	}
+	for i, ex := range rt.exchanges {
+		if ex.Method != method {
+			continue
+		}
+		if got, err := paramsValue(ex.Params); err == nil && reflect.DeepEqual(got, want) {
+			return &rt.exchanges[i]
+		}
+	}
+	return nil
+}
+
+// paramsValue decodes JSON-RPC params, missing and null params being an empty list.
+func paramsValue(params json.RawMessage) (interface{}, error) {
+	var v interface{}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &v); err != nil {
+			return nil, err
+		}
+	}
+	if v == nil {
+		v = []interface{}{}
+	}
+	return v, nil
+}
+
+// recordTransport forwards JSON-RPC requests to the node and rewrites the fixture file with
+// every exchange so far.
+type recordTransport struct {
+	base http.RoundTripper
+	path string
+
+	mu        sync.Mutex
+	exchanges []fixtureExchange
+}
+
+func (rt *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := rt.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	requests, _, err := parseMessages(body)
+	if err != nil {
+		return resp, nil
+	}
+	responses, _, err := parseMessages(data)
+	if err != nil {
+		logger.Warn("failed to record trace fixture", "err", err)
+		return resp, nil
+	}
+	byID := make(map[string]jsonrpcMessage, len(responses))
+	for _, r := range responses {
+		byID[string(r.ID)] = r
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for _, r := range requests {
+		res, ok := byID[string(r.ID)]
+		if !ok {
+			continue
+		}
+		rt.exchanges = append(rt.exchanges, fixtureExchange{Method: r.Method, Params: r.Params, Result: res.Result, Error: res.Error})
+	}
+	out, err := json.MarshalIndent(rt.exchanges, "", "  ")
+	if err == nil {
+		err = os.WriteFile(rt.path, append(out, '\n'), 0o644)
+	}
+	if err != nil {
+		logger.Warn("failed to write trace fixtures", "file", rt.path, "err", err)
+	}
+	return resp, nil
+}
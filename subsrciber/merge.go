@@ -0,0 +1,215 @@
+package subsrciber
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+// proxyEventSignatures are the events emitted by EIP-1967 proxies themselves. Explorers return
+// the implementation ABI for a proxy, which usually lacks them. They are merged after the
+// proxy's own ABI, so they only matter when it is unverified or lacks them.
+var proxyEventSignatures = []string{
+	"Upgraded(address indexed implementation)",
+	"AdminChanged(address previousAdmin, address newAdmin)",
+	"BeaconUpgraded(address indexed beacon)",
+}
+
+// abiPart is one of the ABIs merged into the decoder ABI.
+type abiPart struct {
+	source string
+	abi    abi.ABI
+}
+
+// mergeABIs builds the union of the events and methods of parts, given by decreasing
+// precedence:
+//   - fragments sharing a topic0 (or 4-byte selector) decode the same logs, the first one is
+//     kept and a warning is logged when the later one names or indexes its parameters differently
+//   - fragments sharing a name but not a signature are overloads, both are kept and the later
+//     one is renamed with a numeric suffix, as go-ethereum does
+//
+// Constructor, fallback, receive and errors are taken from the first part.
+func mergeABIs(parts ...abiPart) abi.ABI {
+	if len(parts) == 0 {
+		return abi.ABI{}
+	}
+	merged := parts[0].abi
+	merged.Events = make(map[string]abi.Event)
+	merged.Methods = make(map[string]abi.Method)
+
+	eventSources := make(map[string]string)
+	methodSources := make(map[string]string)
+	for _, part := range parts {
+		for _, e := range sortedEvents(part.abi) {
+			if kept, ok := findEvent(merged, e.Sig); ok {
+				if !sameArguments(kept.Inputs, e.Inputs) {
+					logger.Warn("conflicting event fragments, keeping the first",
+						"signature", e.Sig,
+						"kept", eventSources[kept.Name]+":"+describeArguments(kept.Inputs),
+						"dropped", part.source+":"+describeArguments(e.Inputs))
+				}
+				continue
+			}
+			name := freeName(e.RawName, func(n string) bool { _, ok := merged.Events[n]; return ok })
+			merged.Events[name] = abi.NewEvent(name, e.RawName, e.Anonymous, e.Inputs)
+			eventSources[name] = part.source
+		}
+		for _, m := range sortedMethods(part.abi) {
+			if kept, ok := findMethod(merged, m.Sig); ok {
+				if !sameArguments(kept.Inputs, m.Inputs) {
+					logger.Warn("conflicting method fragments, keeping the first",
+						"signature", m.Sig,
+						"kept", methodSources[kept.Name],
+						"dropped", part.source)
+				}
+				continue
+			}
+			name := freeName(m.RawName, func(n string) bool { _, ok := merged.Methods[n]; return ok })
+			merged.Methods[name] = abi.NewMethod(name, m.RawName, m.Type, m.StateMutability, m.Constant, m.Payable, m.Inputs, m.Outputs)
+			methodSources[name] = part.source
+		}
+	}
+	return merged
+}
+
+// decoderABI merges the resolved ABI with the user-supplied fragments of opts.ABI.Extra.
+// When parsed belongs to the implementation of a proxy, proxy is the proxy's own ABI, merged
+// after it together with the standard proxy events.
+func decoderABI(opts *cli.Config, parsed abi.ABI, proxy *abi.ABI) (abi.ABI, error) {
+	extra, err := extraABI(opts)
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	if len(extra.Events) == 0 && len(extra.Methods) == 0 && proxy == nil {
+		return parsed, nil
+	}
+
+	parts := []abiPart{{source: "extra", abi: extra}, {source: "contract", abi: parsed}}
+	if proxy != nil {
+		standard, err := parseEventSignatures(proxyEventSignatures)
+		if err != nil {
+			return abi.ABI{}, err
+		}
+		parts = append(parts, abiPart{source: "proxy", abi: *proxy}, abiPart{source: "proxy-standard", abi: standard})
+	}
+	merged := mergeABIs(parts...)
+	// keep the contract's constructor, fallback and errors rather than the extras'
+	merged.Constructor, merged.Fallback, merged.Receive, merged.Errors = parsed.Constructor, parsed.Fallback, parsed.Receive, parsed.Errors
+	return merged, nil
+}
+
+// extraABI builds the ABI of the user-supplied fragments. Entries containing "(" are event
+// signatures, the others are ABI or artifact files.
+func extraABI(opts *cli.Config) (abi.ABI, error) {
+	var signatures []string
+	var parts []abiPart
+	for _, entry := range opts.ABI.Extra {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "("):
+			signatures = append(signatures, entry)
+		default:
+			parsed, err := loadABIFile(entry)
+			if err != nil {
+				return abi.ABI{}, fmt.Errorf("extra ABI: %w", err)
+			}
+			parts = append(parts, abiPart{source: entry, abi: parsed})
+		}
+	}
+	if len(signatures) > 0 {
+		parsed, err := parseEventSignatures(signatures)
+		if err != nil {
+			return abi.ABI{}, fmt.Errorf("extra ABI: %w", err)
+		}
+		parts = append([]abiPart{{source: "signatures", abi: parsed}}, parts...)
+	}
+	return mergeABIs(parts...), nil
+}
+
+func findEvent(a abi.ABI, sig string) (abi.Event, bool) {
+	for _, e := range a.Events {
+		if e.Sig == sig {
+			return e, true
+		}
+	}
+	return abi.Event{}, false
+}
+
+func findMethod(a abi.ABI, sig string) (abi.Method, bool) {
+	for _, m := range a.Methods {
+		if m.Sig == sig {
+			return m, true
+		}
+	}
+	return abi.Method{}, false
+}
+
+// freeName returns name, or name followed by the first numeric suffix not taken.
+func freeName(name string, taken func(string) bool) string {
+	if !taken(name) {
+		return name
+	}
+	for i := 0; ; i++ {
+		if n := fmt.Sprintf("%s%d", name, i); !taken(n) {
+			return n
+		}
+	}
+}
+
+// sameArguments reports whether two argument lists with the same types also agree on
+// names and indexed flags.
+func sameArguments(a, b abi.Arguments) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Indexed != b[i].Indexed {
+			return false
+		}
+	}
+	return true
+}
+
+func describeArguments(args abi.Arguments) string {
+	parts := make([]string, 0, len(args))
+	for _, a := range args {
+		s := a.Type.String()
+		if a.Indexed {
+			s += " indexed"
+		}
+		parts = append(parts, strings.TrimSpace(s+" "+a.Name))
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// sortedEvents returns the events of a in name order, so overload suffixes are stable.
+func sortedEvents(a abi.ABI) []abi.Event {
+	names := make([]string, 0, len(a.Events))
+	for n := range a.Events {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	events := make([]abi.Event, 0, len(names))
+	for _, n := range names {
+		events = append(events, a.Events[n])
+	}
+	return events
+}
+
+// sortedMethods returns the methods of a in name order.
+func sortedMethods(a abi.ABI) []abi.Method {
+	names := make([]string, 0, len(a.Methods))
+	for n := range a.Methods {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	methods := make([]abi.Method, 0, len(names))
+	for _, n := range names {
+		methods = append(methods, a.Methods[n])
+	}
+	return methods
+}
@@ -0,0 +1,185 @@
+package subsrciber
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+// signaturesABI builds an ABI from event signatures.
+func signaturesABI(t *testing.T, signatures ...string) abi.ABI {
+	t.Helper()
+	parsed, err := parseEventSignatures(signatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// describeEvents maps every event name of a to its arguments, e.g.
+// "Transfer": "(address indexed from, address indexed to, uint256 value)".
+func describeEvents(a abi.ABI) map[string]string {
+	out := make(map[string]string, len(a.Events))
+	for name, e := range a.Events {
+		out[name] = describeArguments(e.Inputs)
+	}
+	return out
+}
+
+func TestMergeABIs(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		parts [][]string
+		want  map[string]string
+	}{
+		{
+			name: "same signature keeps the first part's names",
+			parts: [][]string{
+				{"Transfer(address indexed src, address indexed dst, uint256 wad)"},
+				{"Transfer(address indexed from, address indexed to, uint256 value)"},
+			},
+			want: map[string]string{"Transfer": "(address indexed src, address indexed dst, uint256 wad)"},
+		},
+		{
+			name: "same signature keeps the first part's indexed flags",
+			parts: [][]string{
+				{"Transfer(address indexed from, address indexed to, uint256 value)"},
+				{"Transfer(address indexed from, address indexed to, uint256 indexed tokenId)"},
+			},
+			want: map[string]string{"Transfer": "(address indexed from, address indexed to, uint256 value)"},
+		},
+		{
+			name: "overloads from later parts are suffixed",
+			parts: [][]string{
+				{"Transfer(address indexed from, address indexed to, uint256 value)"},
+				{"Transfer(address indexed operator, address indexed from, address to, uint256 id)"},
+				{"Transfer(address from, address to)"},
+			},
+			want: map[string]string{
+				"Transfer":  "(address indexed from, address indexed to, uint256 value)",
+				"Transfer0": "(address indexed operator, address indexed from, address to, uint256 id)",
+				"Transfer1": "(address from, address to)",
+			},
+		},
+		{
+			name: "overload suffixes skip names already taken",
+			parts: [][]string{
+				{"Transfer0(uint256 a)", "Transfer(address a)"},
+				{"Transfer(uint256 b)"},
+			},
+			want: map[string]string{
+				"Transfer":  "(address a)",
+				"Transfer0": "(uint256 a)",
+				"Transfer1": "(uint256 b)",
+			},
+		},
+		{
+			name: "events missing from earlier parts are added",
+			parts: [][]string{
+				{"Upgraded(address indexed implementation)"},
+				{"Upgraded(address indexed impl)", "AdminChanged(address previousAdmin, address newAdmin)"},
+			},
+			want: map[string]string{
+				"Upgraded":     "(address indexed implementation)",
+				"AdminChanged": "(address previousAdmin, address newAdmin)",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parts := make([]abiPart, len(tc.parts))
+			for i, sigs := range tc.parts {
+				parts[i] = abiPart{source: string(rune('a' + i)), abi: signaturesABI(t, sigs...)}
+			}
+			got := describeEvents(mergeABIs(parts...))
+			if len(got) != len(tc.want) {
+				t.Errorf("got events %v, want %v", got, tc.want)
+			}
+			for name, args := range tc.want {
+				if got[name] != args {
+					t.Errorf("%s: got %q, want %q", name, got[name], args)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeABIsMethods(t *testing.T) {
+	first, err := abi.JSON(strings.NewReader(`[
+		{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := abi.JSON(strings.NewReader(`[
+		{"type":"function","name":"transfer","inputs":[{"name":"dst","type":"address"},{"name":"wad","type":"uint256"}],"outputs":[]},
+		{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"id","type":"uint256"},{"name":"data","type":"bytes"}],"outputs":[]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := mergeABIs(abiPart{source: "first", abi: first}, abiPart{source: "second", abi: second})
+
+	var names []string
+	for name, m := range merged.Methods {
+		names = append(names, name+" "+m.Sig)
+	}
+	sort.Strings(names)
+	want := []string{"transfer transfer(address,uint256)", "transfer0 transfer(address,uint256,bytes)"}
+	if strings.Join(names, "; ") != strings.Join(want, "; ") {
+		t.Errorf("got %v, want %v", names, want)
+	}
+	if arg := merged.Methods["transfer"].Inputs[0].Name; arg != "to" {
+		t.Errorf("transfer kept the later fragment, first argument %q", arg)
+	}
+}
+
+func TestDecoderABI(t *testing.T) {
+	contract := signaturesABI(t,
+		"Transfer(address indexed from, address indexed to, uint256 value)",
+		"Upgraded(address indexed newImplementation)")
+	proxy := signaturesABI(t,
+		"Upgraded(address indexed implementation)",
+		"AdminChanged(address oldAdmin, address newAdmin)",
+		"Paused(address account)")
+
+	opts := cli.Defaults()
+	if got, err := decoderABI(opts, contract, nil); err != nil || len(got.Events) != len(contract.Events) {
+		t.Errorf("without extras or proxy: got %v, %v; want the contract ABI", describeEvents(got), err)
+	}
+
+	// extra > contract > proxy > proxy-standard
+	opts.ABI.Extra = []string{"Paused(address indexed by)", "Transfer(address indexed src, address indexed dst, uint256 wad)"}
+	got, err := decoderABI(opts, contract, &proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Transfer":       "(address indexed src, address indexed dst, uint256 wad)",
+		"Paused":         "(address indexed by)",
+		"Upgraded":       "(address indexed newImplementation)",
+		"AdminChanged":   "(address oldAdmin, address newAdmin)",
+		"BeaconUpgraded": "(address indexed beacon)",
+	}
+	events := describeEvents(got)
+	if len(events) != len(want) {
+		t.Errorf("got events %v, want %v", events, want)
+	}
+	for name, args := range want {
+		if events[name] != args {
+			t.Errorf("%s: got %q, want %q", name, events[name], args)
+		}
+	}
+
+	// an unverified proxy falls back to the standard proxy events
+	opts.ABI.Extra = nil
+	got, err = decoderABI(opts, contract, &abi.ABI{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Events["AdminChanged"]; !ok {
+		t.Errorf("standard proxy events missing: %v", describeEvents(got))
+	}
+}
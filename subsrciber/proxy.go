@@ -0,0 +1,180 @@
+package subsrciber
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/naman1402/geth-indexer/metrics"
+)
+
+// Proxy standards recognised by DetectProxy.
+const (
+	ProxyEIP1967       = "eip1967"
+	ProxyEIP1967Beacon = "eip1967-beacon"
+	ProxyEIP1822       = "eip1822"
+	ProxyOZLegacy      = "oz-legacy"
+	ProxyEIP1167       = "eip1167"
+)
+
+var (
+	// bytes32(uint256(keccak256("eip1967.proxy.implementation")) - 1)
+	eip1967ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	// bytes32(uint256(keccak256("eip1967.proxy.beacon")) - 1)
+	eip1967BeaconSlot = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+	// keccak256("PROXIABLE")
+	eip1822Slot = common.HexToHash("0xc5f16f0fcc639fa48a6947836d9850f504798523bf8c9a3a87d5876cf622bcf7")
+	// keccak256("org.zeppelinos.proxy.implementation")
+	ozLegacySlot = common.HexToHash("0x7050c9e0f4ca769c69bd3a8ef740bc37934f8e2c036e5a723fd8ee048ed3f8c3")
+
+	// EIP-1167 runtime code around the PUSHn of the implementation address
+	eip1167Prefix = common.FromHex("0x363d3d373d3d3d363d")
+	eip1167Suffix = common.FromHex("0x5af43d82803e903d91602b57fd5bf3")
+
+	// implementation() and childImplementation(), called on beacons
+	beaconSelectors = [][]byte{common.FromHex("0x5c60da1b"), common.FromHex("0xda525716")}
+)
+
+// StateReader is the part of ethclient.Client used to inspect contract state.
+type StateReader interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// ProxyInfo describes a proxy detected from chain state.
+type ProxyInfo struct {
+	// Kind is one of the Proxy* constants.
+	Kind           string
+	Implementation common.Address
+	// Beacon is set for beacon proxies.
+	Beacon common.Address
+}
+
+// DetectProxy reads the code and the well-known implementation slots of address at block
+// (nil means latest). It returns nil when address is not a recognised proxy.
+func DetectProxy(ctx context.Context, client StateReader, address common.Address, block *big.Int) (*ProxyInfo, error) {
+	code, err := client.CodeAt(ctx, address, block)
+	metrics.ObserveRPC("eth_getCode", err)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("no contract code at %s", address.Hex())
+	}
+	if impl, ok := minimalProxyTarget(code); ok {
+		return &ProxyInfo{Kind: ProxyEIP1167, Implementation: impl}, nil
+	}
+
+	impl, err := slotAddress(ctx, client, address, eip1967ImplementationSlot, block)
+	if err != nil {
+		return nil, err
+	}
+	if impl != (common.Address{}) {
+		return &ProxyInfo{Kind: ProxyEIP1967, Implementation: impl}, nil
+	}
+
+	beacon, err := slotAddress(ctx, client, address, eip1967BeaconSlot, block)
+	if err != nil {
+		return nil, err
+	}
+	if beacon != (common.Address{}) {
+		impl, err := beaconImplementation(ctx, client, beacon, block)
+		if err != nil {
+			return nil, fmt.Errorf("beacon %s: %w", beacon.Hex(), err)
+		}
+		return &ProxyInfo{Kind: ProxyEIP1967Beacon, Implementation: impl, Beacon: beacon}, nil
+	}
+
+	for _, s := range []struct {
+		kind string
+		slot common.Hash
+	}{{ProxyEIP1822, eip1822Slot}, {ProxyOZLegacy, ozLegacySlot}} {
+		impl, err := slotAddress(ctx, client, address, s.slot, block)
+		if err != nil {
+			return nil, err
+		}
+		if impl != (common.Address{}) {
+			return &ProxyInfo{Kind: s.kind, Implementation: impl}, nil
+		}
+	}
+	return nil, nil
+}
+
+// slotAddress reads an address stored in the low 20 bytes of a storage slot.
+func slotAddress(ctx context.Context, client StateReader, address common.Address, slot common.Hash, block *big.Int) (common.Address, error) {
+	value, err := client.StorageAt(ctx, address, slot, block)
+	metrics.ObserveRPC("eth_getStorageAt", err)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(value), nil
+}
+
+// beaconImplementation asks a beacon for its current implementation.
+func beaconImplementation(ctx context.Context, client StateReader, beacon common.Address, block *big.Int) (common.Address, error) {
+	for _, selector := range beaconSelectors {
+		out, err := client.CallContract(ctx, ethereum.CallMsg{To: &beacon, Data: selector}, block)
+		metrics.ObserveRPC("eth_call", err)
+		if err == nil && len(out) >= common.HashLength {
+			if impl := common.BytesToAddress(out[:common.HashLength]); impl != (common.Address{}) {
+				return impl, nil
+			}
+		}
+	}
+	return common.Address{}, errors.New("beacon returned no implementation")
+}
+
+// minimalProxyTarget returns the implementation of an EIP-1167 minimal proxy. Vanity
+// variants pushing a shortened address (PUSH1 to PUSH20) are accepted.
+func minimalProxyTarget(code []byte) (common.Address, bool) {
+	if !bytes.HasPrefix(code, eip1167Prefix) || len(code) <= len(eip1167Prefix) {
+		return common.Address{}, false
+	}
+	push := code[len(eip1167Prefix)]
+	if push < 0x60 || push > 0x73 {
+		return common.Address{}, false
+	}
+	n := int(push-0x60) + 1
+	start := len(eip1167Prefix) + 1
+	if len(code) != start+n+len(eip1167Suffix) || !bytes.Equal(code[start+n:], eip1167Suffix) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(code[start : start+n]), true
+}
+
+// ChainProxyResolver detects proxies from chain state and resolves the ABI of their
+// implementation with Resolver, so explorer proxy flags are not needed.
+type ChainProxyResolver struct {
+	Client   StateReader
+	Resolver ABIResolver
+}
+
+// Name implements ABIResolver.
+func (r *ChainProxyResolver) Name() string { return r.Resolver.Name() }
+
+// Resolve implements ABIResolver. When detection fails Resolver is asked for address itself.
+func (r *ChainProxyResolver) Resolve(ctx context.Context, address common.Address) (*ResolvedABI, error) {
+	info, err := DetectProxy(ctx, r.Client, address, nil)
+	if err != nil {
+		logger.Warn("on-chain proxy detection failed", "contract", address.Hex(), "err", err)
+	}
+	if err != nil || info == nil {
+		return r.Resolver.Resolve(ctx, address)
+	}
+
+	logger.Info("contract is a proxy, using the implementation ABI",
+		"contract", address.Hex(),
+		"kind", info.Kind,
+		"implementation", info.Implementation.Hex())
+	res, err := r.Resolver.Resolve(ctx, info.Implementation)
+	if err != nil {
+		return nil, fmt.Errorf("implementation %s: %w", info.Implementation.Hex(), err)
+	}
+	res.Implementation = info.Implementation
+	return res, nil
+}
@@ -0,0 +1,128 @@
+package subsrciber
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// How an Event was decoded, stored in the "decodedBy" column.
+const (
+	// DecodedByABI means the log matched an event of the contract ABI.
+	DecodedByABI = "abi"
+	// DecodedBySignature means the log only matched a known event signature of the
+	// embedded registry, so parameter names are the standard ones, not the contract's.
+	DecodedBySignature = "signature"
+)
+
+//go:embed signatures.txt
+var signatureList string
+
+// registryKey identifies an event by its topic0 and the number of indexed arguments, which
+// tells apart events sharing a signature such as ERC-20 and ERC-721 Transfer.
+type registryKey struct {
+	topic   common.Hash
+	indexed int
+}
+
+// registryEntry is a known event and an ABI holding only that event.
+type registryEntry struct {
+	name string
+	abi  abi.ABI
+}
+
+var registry = loadRegistry(signatureList)
+
+// loadRegistry parses the embedded signature list. It panics on a malformed line since the
+// list is compiled in.
+func loadRegistry(list string) map[registryKey]registryEntry {
+	entries := make(map[registryKey]registryEntry)
+	for i, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parsed, err := parseEventSignatures([]string{line})
+		if err != nil {
+			panic(fmt.Sprintf("signatures.txt:%d: %v", i+1, err))
+		}
+		for _, e := range parsed.Events {
+			indexed := 0
+			for _, in := range e.Inputs {
+				if in.Indexed {
+					indexed++
+				}
+			}
+			key := registryKey{topic: e.ID, indexed: indexed}
+			if _, ok := entries[key]; ok {
+				panic(fmt.Sprintf("signatures.txt:%d: duplicate signature %s", i+1, e.Sig))
+			}
+			entries[key] = registryEntry{name: e.RawName, abi: parsed}
+		}
+	}
+	return entries
+}
+
+// lookupSignature finds the registry event matching the topics of a log.
+func lookupSignature(topics []common.Hash) (registryEntry, bool) {
+	if len(topics) == 0 {
+		return registryEntry{}, false
+	}
+	e, ok := registry[registryKey{topic: topics[0], indexed: len(topics) - 1}]
+	return e, ok
+}
+
+// historicalTopics returns the topic0 filter for historical logs: the events of the ABI
+// timeline and, with the signature fallback, the registry events among the requested ones.
+// It returns nil, no filter, when the ABI is empty or an anonymous event is requested.
+func (c *Contract) historicalTopics(events []string) []common.Hash {
+	if len(c.events) == 0 || c.requestsAnonymous(events) {
+		return nil
+	}
+	topics := c.topics()
+	if !c.fallback {
+		return topics
+	}
+	seen := make(map[common.Hash]bool, len(topics))
+	for _, t := range topics {
+		seen[t] = true
+	}
+	for _, t := range signatureTopics(events) {
+		if !seen[t] {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// requestsAnonymous reports whether a requested event of the ABI timeline is anonymous.
+func (c *Contract) requestsAnonymous(events []string) bool {
+	abis := []abi.ABI{c.ABI}
+	for _, v := range c.history {
+		abis = append(abis, v.abi)
+	}
+	for _, a := range abis {
+		for _, e := range a.Events {
+			if e.Anonymous && EventRequested(events, e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// signatureTopics returns the topic0 of the requested registry events.
+func signatureTopics(events []string) []common.Hash {
+	seen := make(map[common.Hash]bool)
+	var topics []common.Hash
+	for key, e := range registry {
+		if EventRequested(events, e.abi.Events[e.name]) && !seen[key.topic] {
+			seen[key.topic] = true
+			topics = append(topics, key.topic)
+		}
+	}
+	return topics
+}
@@ -0,0 +1,161 @@
+package subsrciber
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+// ErrABINotFound is returned by a resolver that has no verified ABI for the address.
+var ErrABINotFound = errors.New("ABI not found")
+
+// ResolvedABI is the result of resolving a contract's ABI.
+type ResolvedABI struct {
+	ABI abi.ABI
+	// JSON is the ABI as returned by the source, kept for the ABI cache.
+	JSON json.RawMessage
+	// Source is the name of the resolver that returned the ABI.
+	Source string
+	// Implementation is set when the address is a proxy and ABI belongs to its implementation.
+	Implementation common.Address
+}
+
+// ABIResolver resolves the ABI of a contract, following proxies to their implementation.
+type ABIResolver interface {
+	// Name identifies the resolver in logs and errors, e.g. "etherscan".
+	Name() string
+	Resolve(ctx context.Context, address common.Address) (*ResolvedABI, error)
+}
+
+// ResolverChain tries its resolvers in order and returns the first ABI found.
+type ResolverChain []ABIResolver
+
+// Name implements ABIResolver.
+func (c ResolverChain) Name() string {
+	names := make([]string, 0, len(c))
+	for _, r := range c {
+		names = append(names, r.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Resolve implements ABIResolver. The returned error joins the errors of every resolver.
+func (c ResolverChain) Resolve(ctx context.Context, address common.Address) (*ResolvedABI, error) {
+	var errs []error
+	for _, r := range c {
+		res, err := r.Resolve(ctx, address)
+		if err == nil {
+			return res, nil
+		}
+		logger.Warn("ABI resolver failed, trying the next one", "resolver", r.Name(), "contract", address.Hex(), "err", err)
+		errs = append(errs, fmt.Errorf("%s: %w", r.Name(), err))
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no ABI resolver configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// NewResolver builds the resolver chain in the order configured by opts.API.Resolvers.
+func NewResolver(opts *cli.Config) (ResolverChain, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	var chain ResolverChain
+	for _, name := range opts.API.Resolvers {
+		switch strings.TrimSpace(name) {
+		case "etherscan":
+			baseURL := opts.API.EtherscanURL
+			if u, ok := opts.API.EtherscanURLs[opts.API.ChainID]; ok {
+				baseURL = u
+			}
+			chain = append(chain, &EtherscanResolver{
+				BaseURL: baseURL,
+				ChainID: opts.API.ChainID,
+				APIKey:  opts.API.EtherscanAPI,
+				Client:  client,
+			})
+		case "sourcify":
+			chain = append(chain, &SourcifyResolver{
+				BaseURL: opts.API.SourcifyURL,
+				ChainID: opts.API.ChainID,
+				Client:  client,
+			})
+		case "blockscout":
+			chain = append(chain, &BlockscoutResolver{
+				BaseURL: opts.API.BlockscoutURL,
+				Client:  client,
+			})
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown ABI resolver %q", name)
+		}
+	}
+	return chain, nil
+}
+
+// skipProxies makes every resolver of the chain return the ABI of the address itself.
+func (c ResolverChain) skipProxies() {
+	for _, r := range c {
+		switch r := r.(type) {
+		case *EtherscanResolver:
+			r.SkipProxies = true
+		case *SourcifyResolver:
+			r.SkipProxies = true
+		case *BlockscoutResolver:
+			r.SkipProxies = true
+		}
+	}
+}
+
+// setABI parses the ABI JSON text into r.
+func (r *ResolvedABI) setABI(data []byte) error {
+	parsed, err := abi.JSON(strings.NewReader(string(data)))
+	if err != nil {
+		return err
+	}
+	r.ABI, r.JSON = parsed, json.RawMessage(data)
+	return nil
+}
+
+// getJSON performs a GET request and decodes the JSON response body into out.
+// A 404 response is reported as ErrABINotFound.
+func getJSON(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.Warn("failed to close response body", "err", err)
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrABINotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
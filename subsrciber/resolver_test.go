@@ -0,0 +1,279 @@
+package subsrciber
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+const (
+	transferABI = `[{"type":"event","name":"Transfer","anonymous":false,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}]`
+	upgradedABI = `[{"type":"event","name":"Upgraded","anonymous":false,"inputs":[{"name":"implementation","type":"address","indexed":true}]}]`
+)
+
+var (
+	proxyAddress = common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	implAddress  = common.HexToAddress("0x43506849D7C04F9138D1A2050bbF3A0c054402dd")
+)
+
+// countingServer serves handler and counts the requests it received.
+func countingServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	calls := new(atomic.Int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, calls
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestEtherscanResolver(t *testing.T) {
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("chainid") != "1" || q.Get("apikey") != "key" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		address := common.HexToAddress(q.Get("address"))
+		switch q.Get("action") {
+		case "getsourcecode":
+			result := []map[string]string{{"Proxy": "0", "Implementation": ""}}
+			if address == proxyAddress {
+				result = []map[string]string{{"Proxy": "1", "Implementation": implAddress.Hex()}}
+			}
+			writeJSON(w, map[string]interface{}{"status": "1", "message": "OK", "result": result})
+		case "getabi":
+			if address != implAddress {
+				writeJSON(w, map[string]string{"status": "0", "message": "NOTOK", "result": "Contract source code not verified"})
+				return
+			}
+			writeJSON(w, map[string]string{"status": "1", "message": "OK", "result": transferABI})
+		}
+	})
+	r := &EtherscanResolver{BaseURL: srv.URL, ChainID: 1, APIKey: "key", Client: srv.Client()}
+
+	res, err := r.Resolve(context.Background(), proxyAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Implementation != implAddress || res.Source != "etherscan" {
+		t.Errorf("got implementation %s from %s, want %s from etherscan", res.Implementation.Hex(), res.Source, implAddress.Hex())
+	}
+	if _, ok := res.ABI.Events["Transfer"]; !ok {
+		t.Errorf("Transfer missing from resolved ABI")
+	}
+
+	_, err = r.Resolve(context.Background(), common.HexToAddress("0x01"))
+	if !errors.Is(err, ErrContractNotVerified) || !errors.Is(err, ErrABINotFound) {
+		t.Errorf("got %v, want ErrContractNotVerified", err)
+	}
+}
+
+func TestEtherscanResolverErrors(t *testing.T) {
+	for _, tc := range []struct {
+		result string
+		want   error
+	}{
+		{"Max rate limit reached", ErrRateLimited},
+		{"Invalid API Key", ErrInvalidAPIKey},
+		{"Missing or unsupported chainid parameter", ErrUnsupportedChain},
+	} {
+		srv, calls := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]string{"status": "0", "message": "NOTOK", "result": tc.result})
+		})
+		r := &EtherscanResolver{BaseURL: srv.URL, APIKey: "key", Client: srv.Client()}
+		_, err := r.Resolve(context.Background(), proxyAddress)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.result, err, tc.want)
+		}
+		// getabi is not called once getsourcecode reports a fatal error
+		if calls.Load() != 1 {
+			t.Errorf("%q: %d requests, want 1", tc.result, calls.Load())
+		}
+	}
+}
+
+func TestSourcifyResolver(t *testing.T) {
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf("/v2/contract/1/%s", proxyAddress.Hex()):
+			writeJSON(w, map[string]interface{}{
+				"abi": json.RawMessage(upgradedABI),
+				"proxyResolution": map[string]interface{}{
+					"isProxy":         true,
+					"implementations": []map[string]string{{"address": implAddress.Hex()}},
+				},
+			})
+		case fmt.Sprintf("/v2/contract/1/%s", implAddress.Hex()):
+			if r.URL.Query().Get("fields") != "abi" {
+				t.Errorf("unexpected fields %q", r.URL.Query().Get("fields"))
+			}
+			writeJSON(w, map[string]interface{}{"abi": json.RawMessage(transferABI)})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	r := &SourcifyResolver{BaseURL: srv.URL + "/", ChainID: 1, Client: srv.Client()}
+
+	res, err := r.Resolve(context.Background(), proxyAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Implementation != implAddress {
+		t.Errorf("got implementation %s, want %s", res.Implementation.Hex(), implAddress.Hex())
+	}
+	if _, ok := res.ABI.Events["Transfer"]; !ok {
+		t.Errorf("Transfer missing from resolved ABI")
+	}
+
+	if _, err := r.Resolve(context.Background(), common.HexToAddress("0x01")); !errors.Is(err, ErrABINotFound) {
+		t.Errorf("got %v, want ErrABINotFound", err)
+	}
+}
+
+func TestBlockscoutResolver(t *testing.T) {
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/smart-contracts/" + proxyAddress.Hex():
+			// older Blockscout versions only return implementation_address
+			writeJSON(w, map[string]interface{}{"abi": json.RawMessage(upgradedABI), "implementation_address": implAddress.Hex()})
+		case "/api/v2/smart-contracts/" + implAddress.Hex():
+			writeJSON(w, map[string]interface{}{"abi": json.RawMessage(transferABI), "implementations": []interface{}{}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	r := &BlockscoutResolver{BaseURL: srv.URL, Client: srv.Client()}
+
+	res, err := r.Resolve(context.Background(), proxyAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Implementation != implAddress || res.Source != "blockscout" {
+		t.Errorf("got implementation %s from %s", res.Implementation.Hex(), res.Source)
+	}
+	if _, ok := res.ABI.Events["Transfer"]; !ok {
+		t.Errorf("Transfer missing from resolved ABI")
+	}
+
+	if _, err := r.Resolve(context.Background(), common.HexToAddress("0x01")); !errors.Is(err, ErrABINotFound) {
+		t.Errorf("got %v, want ErrABINotFound", err)
+	}
+}
+
+func TestResolverSkipProxies(t *testing.T) {
+	etherscan, etherscanCalls := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("action") != "getabi" {
+			t.Errorf("unexpected action %q", r.URL.Query().Get("action"))
+		}
+		writeJSON(w, map[string]string{"status": "1", "message": "OK", "result": upgradedABI})
+	})
+	sourcify, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fields") != "abi" {
+			t.Errorf("unexpected fields %q", r.URL.Query().Get("fields"))
+		}
+		writeJSON(w, map[string]interface{}{"abi": json.RawMessage(upgradedABI)})
+	})
+	blockscout, blockscoutCalls := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"abi": json.RawMessage(upgradedABI), "implementation_address": implAddress.Hex()})
+	})
+	chain := ResolverChain{
+		&EtherscanResolver{BaseURL: etherscan.URL, APIKey: "key", Client: etherscan.Client()},
+		&SourcifyResolver{BaseURL: sourcify.URL, ChainID: 1, Client: sourcify.Client()},
+		&BlockscoutResolver{BaseURL: blockscout.URL, Client: blockscout.Client()},
+	}
+	chain.skipProxies()
+
+	for _, r := range chain {
+		res, err := r.Resolve(context.Background(), proxyAddress)
+		if err != nil {
+			t.Fatalf("%s: %v", r.Name(), err)
+		}
+		if res.Implementation != (common.Address{}) {
+			t.Errorf("%s: followed the proxy to %s", r.Name(), res.Implementation.Hex())
+		}
+		if _, ok := res.ABI.Events["Upgraded"]; !ok {
+			t.Errorf("%s: Upgraded missing from the proxy ABI", r.Name())
+		}
+	}
+	if etherscanCalls.Load() != 1 || blockscoutCalls.Load() != 1 {
+		t.Errorf("calls: etherscan %d, blockscout %d", etherscanCalls.Load(), blockscoutCalls.Load())
+	}
+}
+
+func TestResolverChainFallback(t *testing.T) {
+	etherscan, etherscanCalls := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"status": "0", "message": "NOTOK", "result": "Contract source code not verified"})
+	})
+	sourcify, sourcifyCalls := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	blockscout, blockscoutCalls := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"abi": json.RawMessage(transferABI)})
+	})
+	chain := ResolverChain{
+		&EtherscanResolver{BaseURL: etherscan.URL, APIKey: "key", Client: etherscan.Client()},
+		&SourcifyResolver{BaseURL: sourcify.URL, ChainID: 1, Client: sourcify.Client()},
+		&BlockscoutResolver{BaseURL: blockscout.URL, Client: blockscout.Client()},
+	}
+	if got := chain.Name(); got != "etherscan,sourcify,blockscout" {
+		t.Errorf("got name %q", got)
+	}
+
+	res, err := chain.Resolve(context.Background(), proxyAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != "blockscout" {
+		t.Errorf("got ABI from %s, want blockscout", res.Source)
+	}
+	if etherscanCalls.Load() == 0 || sourcifyCalls.Load() != 1 || blockscoutCalls.Load() != 1 {
+		t.Errorf("calls: etherscan %d, sourcify %d, blockscout %d", etherscanCalls.Load(), sourcifyCalls.Load(), blockscoutCalls.Load())
+	}
+
+	// the first resolver that finds the ABI wins, later ones are not asked
+	blockscoutCalls.Store(0)
+	res, err = ResolverChain{chain[2], chain[1]}.Resolve(context.Background(), proxyAddress)
+	if err != nil || res.Source != "blockscout" || blockscoutCalls.Load() != 1 || sourcifyCalls.Load() != 1 {
+		t.Errorf("got %v, %v; calls: sourcify %d, blockscout %d", res, err, sourcifyCalls.Load(), blockscoutCalls.Load())
+	}
+
+	_, err = ResolverChain{chain[0], chain[1]}.Resolve(context.Background(), proxyAddress)
+	if !errors.Is(err, ErrContractNotVerified) || !errors.Is(err, ErrABINotFound) {
+		t.Errorf("got %v, want the joined errors of every resolver", err)
+	}
+}
+
+func TestNewResolverOrder(t *testing.T) {
+	opts := cli.Defaults()
+	opts.API.Resolvers = []string{"blockscout", " sourcify", "etherscan"}
+	opts.API.EtherscanURLs = map[int64]string{1: "https://explorer.example/api"}
+	chain, err := NewResolver(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chain.Name(); got != "blockscout,sourcify,etherscan" {
+		t.Errorf("got %q", got)
+	}
+	if u := chain[2].(*EtherscanResolver).BaseURL; u != "https://explorer.example/api" {
+		t.Errorf("per-chain Etherscan URL not used: %s", u)
+	}
+
+	opts.API.Resolvers = []string{"etherscan", "unknown"}
+	if _, err := NewResolver(opts); err == nil {
+		t.Error("unknown resolver accepted")
+	}
+}
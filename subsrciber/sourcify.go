@@ -0,0 +1,72 @@
+package subsrciber
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SourcifyResolver resolves ABIs of contracts verified on Sourcify through its v2 API.
+type SourcifyResolver struct {
+	// BaseURL is the Sourcify server URL, e.g. https://sourcify.dev/server.
+	BaseURL string
+	ChainID int64
+	Client  *http.Client
+	// SkipProxies returns the ABI of the address itself, without following proxyResolution.
+	SkipProxies bool
+}
+
+type sourcifyContract struct {
+	ABI             json.RawMessage `json:"abi"`
+	ProxyResolution *struct {
+		IsProxy         bool `json:"isProxy"`
+		Implementations []struct {
+			Address string `json:"address"`
+		} `json:"implementations"`
+	} `json:"proxyResolution"`
+}
+
+// Name implements ABIResolver.
+func (r *SourcifyResolver) Name() string { return "sourcify" }
+
+// Resolve implements ABIResolver.
+func (r *SourcifyResolver) Resolve(ctx context.Context, address common.Address) (*ResolvedABI, error) {
+	fields := "abi,proxyResolution"
+	if r.SkipProxies {
+		fields = "abi"
+	}
+	contract, err := r.contract(ctx, address, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ResolvedABI{Source: r.Name()}
+	if p := contract.ProxyResolution; !r.SkipProxies && p != nil && p.IsProxy && len(p.Implementations) > 0 {
+		res.Implementation = common.HexToAddress(p.Implementations[0].Address)
+		logger.Info("contract is a proxy, using the implementation ABI", "resolver", r.Name(), "contract", address.Hex(), "implementation", res.Implementation.Hex())
+		if contract, err = r.contract(ctx, res.Implementation, "abi"); err != nil {
+			return nil, fmt.Errorf("implementation %s: %w", res.Implementation.Hex(), err)
+		}
+	}
+
+	if len(contract.ABI) == 0 || string(contract.ABI) == "null" {
+		return nil, ErrABINotFound
+	}
+	if err := res.setABI(contract.ABI); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *SourcifyResolver) contract(ctx context.Context, address common.Address, fields string) (*sourcifyContract, error) {
+	url := fmt.Sprintf("%s/v2/contract/%d/%s?fields=%s", strings.TrimSuffix(r.BaseURL, "/"), r.ChainID, address.Hex(), fields)
+	var contract sourcifyContract
+	if err := getJSON(ctx, r.Client, url, &contract); err != nil {
+		return nil, err
+	}
+	return &contract, nil
+}
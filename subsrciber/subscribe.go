@@ -1,47 +1,97 @@
 package subsrciber
 
 import (
-	"encoding/hex"
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"math/big"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const buffer = 100
+const (
+	buffer = 100
+	// headPollInterval is how often the chain head is fetched for lag reporting
+	headPollInterval = 15 * time.Second
+)
+
+// NewContract builds the Contract for the configured address, loading its ABI and
+// mapping every ABI event to its topic0 hash.
+func NewContract(opts *cli.Config) (*Contract, error) {
+	parsed, impl, err := loadABI(opts, false)
+	switch {
+	case err != nil && opts.ABI.SignatureFallback:
+		// unverified contracts are decoded with the signature registry only
+		logger.Warn("failed to load contract ABI, decoding standard events by signature", "contract", opts.Query.Address, "err", err)
+	case err != nil:
+		return nil, fmt.Errorf("failed to load contract ABI: %w", err)
+	}
+	filters, err := parseTopicFilters(opts.Query.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event filters: %w", err)
+	}
+	c := &Contract{
+		Address:  common.HexToAddress(opts.Query.Address),
+		ABI:      parsed,
+		fallback: opts.ABI.SignatureFallback,
+		filters:  filters,
+		exprs:    opts.Events,
+		// topic0 of every non-anonymous ABI event mapped to its name
+		events: eventTopics(parsed),
+		// set for proxies, whose upgrade history is then loaded by loadUpgrades
+		implementation: impl,
+	}
+	return c, nil
+}
 
-func Subscribe(events []string, eventCh chan<- *Event, opts *cli.Config, quit chan bool) {
+// reload fetches the ABI again, bypassing the ABI cache unless the entry is pinned, and
+// rebuilds the topic mapping. The current ABI is kept when the fetch fails or the fetched
+// one has no events.
+func (c *Contract) reload(opts *cli.Config) reloadResult {
+	parsed, _, err := loadABI(opts, true)
+	if err != nil {
+		return reloadResult{err: err}
+	}
+	if len(parsed.Events) == 0 {
+		return reloadResult{err: errors.New("fetched ABI has no events, keeping the current one")}
+	}
+	c.mu.Lock()
+	c.ABI = parsed
+	c.events = eventTopics(parsed)
+	c.mu.Unlock()
+	return reloadResult{events: len(parsed.Events)}
+}
+
+// Subscribe streams the decoded events of c to eventCh: historical logs first, then live logs.
+// ctl can pause ingestion, schedule backfills and reload the ABI while it runs. It returns
+// nil once ctx is done, or the error that stopped it.
+func Subscribe(ctx context.Context, events []string, eventCh chan<- *Event, opts *cli.Config, c *Contract, ctl *Controller) error {
 
-	fmt.Println("\nSubscribing to events...")
-	fmt.Printf("\nContract Address: %s\nBlock range: %d to %d\nEvents: %s\n", opts.Query.Address, opts.Query.From, opts.Query.To, strings.Join(events, ", "))
+	logger.Info("subscribing to events",
+		"contract", opts.Query.Address,
+		"from", opts.Query.From,
+		"to", opts.Query.To,
+		"events", strings.Join(events, ","))
 
 	// 1. Connecting to EVM using RPC URL
-	client, err := ethclient.Dial(opts.API.EthNodeURL)
+	client, err := ethclient.DialContext(ctx, opts.API.EthNodeURL)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to connect to RPC node: %w", err)
 	}
 	defer client.Close()
 
 	// fmt.Printf("Subscribing to these events on contract %s ... %s\n", opts.Query.Address, strings.Join(events, " "))
-	fmt.Println("\nConnected to RPC URL:", opts.API.EthNodeURL)
-
-	// 2. Initialize a Contract struct with the provided address and ABI ✅
-	c := &Contract{
-		Address: common.HexToAddress(opts.Query.Address),
-		ABI:     fetchABI(opts),
-		// Initially this will be an empty mapping, populated using ABI events
-		events: make(map[common.Hash]string),
-	}
+	logger.Info("connected to RPC node", "url", opts.API.EthNodeURL)
 
-	for _, e := range c.ABI.Events {
-		c.events[e.ID] = e.Name
-	}
+	// 2. Contract (address, ABI and topic mapping) is built by NewContract ✅
 	// fmt.Printf("Contract Events Mapping: %+v\n", c.events)
 	// fmt.Printf("Contract ABI fetched: %+v\n", c.ABI)✅
 	logCh := make(chan types.Log, buffer)
@@ -51,17 +101,32 @@ func Subscribe(events []string, eventCh chan<- *Event, opts *cli.Config, quit ch
 	// starts goroutine that filters historical logs and sends them to logCh ///
 	// Ensures that historical logs are processed and sent to the log channel //
 	////////////////////////////////////////////////////////////////////////////
-	var topicList []common.Hash
-	for h := range c.events {
-		topicList = append(topicList, h)
+	// Earlier implementations of a proxy decode the blocks they were active for
+	c.loadUpgrades(ctx, client, opts)
+	topics, err := c.logTopics(events)
+	if err != nil {
+		return fmt.Errorf("invalid event filters: %w", err)
 	}
-	var topics [][]common.Hash
-	if len(topicList) > 0 {
-		topics = append(topics, topicList)
+	if len(c.filters) > 0 {
+		logger.Info("filtering logs by topic", "filters", opts.Query.Filters, "topics", topics)
 	}
+	if err := c.checkTransforms(events); err != nil {
+		return fmt.Errorf("invalid event expressions: %w", err)
+	}
+	filterErr := make(chan error, 1)
 	go func() {
-		for _, l := range filter(client, opts, topics) {
-			logCh <- l
+		logs, err := filter(ctx, client, opts, topics)
+		if err != nil {
+			filterErr <- fmt.Errorf("failed to filter historical logs: %w", err)
+			return
+		}
+		metrics.LogsReceived.WithLabelValues("historical").Add(float64(len(logs)))
+		for _, l := range logs {
+			select {
+			case logCh <- l:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
@@ -69,78 +134,233 @@ func Subscribe(events []string, eventCh chan<- *Event, opts *cli.Config, quit ch
 	// 4. Subscribe to Real-Time Logs /////////////////////////////////////////
 	// Sets up a subscription to real-time logs from the Ethereum blockchain //
 	///////////////////////////////////////////////////////////////////////////
-	sub, subLogs := listen(client, opts)
+	// live logs are only narrowed by topic when filters are set, every log of the contract
+	// is received otherwise
+	var liveTopics [][]common.Hash
+	if len(c.filters) > 0 {
+		liveTopics = topics
+	}
+	sub, subLogs, err := listen(ctx, client, opts, liveTopics)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to live logs: %w", err)
+	}
+	defer sub.Unsubscribe()
+	// the filtered topics exclude Upgraded, proxies get a separate subscription for it
+	var upgradeErr <-chan error
+	var upgradeLogs <-chan types.Log
+	if len(c.filters) > 0 && c.implementation != (common.Address{}) {
+		upgradeSub, logs, err := listen(ctx, client, opts, [][]common.Hash{{upgradedTopic}})
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to proxy upgrades: %w", err)
+		}
+		defer upgradeSub.Unsubscribe()
+		upgradeLogs, upgradeErr = logs, upgradeSub.Err()
+	}
 	// fmt.Print("listen function called, the output is (sub): ", sub)
 	// fmt.Print("listen function called, the output is (subLogs): ", subLogs)
 
 	// 5. Process Logs
+	ctl.active.Store(true)
+	ctl.rpcConnected.Store(true)
+	ctl.subscribed.Store(true)
+	defer func() {
+		ctl.active.Store(false)
+		ctl.rpcConnected.Store(false)
+		ctl.subscribed.Store(false)
+	}()
+	subErr := sub.Err()
+	// chain head is polled to report indexing lag
+	headTicker := time.NewTicker(headPollInterval)
+	defer headTicker.Stop()
 	for {
 		select {
-		case err := <-sub.Err():
-			log.Println(err)
+		case <-ctx.Done():
+			return nil
+		case err := <-filterErr:
+			return err
+		case err := <-subErr:
+			// the subscription is dead once it reports an error, stop selecting on its closed channel
+			subErr = nil
+			ctl.subscribed.Store(false)
+			metrics.RPCErrors.WithLabelValues("eth_subscribe").Inc()
+			logger.Error("live log subscription failed", "err", err)
+		case err := <-upgradeErr:
+			upgradeErr = nil
+			metrics.RPCErrors.WithLabelValues("eth_subscribe").Inc()
+			logger.Error("proxy upgrade subscription failed", "err", err)
+		case l := <-upgradeLogs:
+			c.upgrade(opts, l)
+		case <-headTicker.C:
+			head, err := client.BlockNumber(ctx)
+			metrics.ObserveRPC("eth_blockNumber", err)
+			ctl.rpcConnected.Store(err == nil)
+			if err != nil {
+				logger.Warn("failed to fetch chain head", "err", err)
+				continue
+			}
+			metrics.ChainHead.Set(float64(head))
+		case req := <-ctl.backfills:
+			ctl.running.Add(1)
+			// include events of implementations upgraded to since startup
+			topics := topics
+			if t, err := c.logTopics(events); err == nil {
+				topics = t
+			}
+			go func() {
+				defer ctl.running.Add(-1)
+				if err := backfill(ctx, client, opts, topics, req.from, req.to, logCh); err != nil {
+					logger.Error("backfill failed", "from", req.from, "to", req.to, "err", err)
+				}
+			}()
+		case done := <-ctl.reloads:
+			done <- c.reload(opts)
+			logger.Info("reloaded contract ABI", "events", len(c.events))
 		case l := <-logCh:
+			if ctl.skip(l.BlockNumber) {
+				metrics.EventsDropped.WithLabelValues("unknown", "paused").Inc()
+				continue
+			}
+			c.upgrade(opts, l)
 			// fmt.Sprintln(events, l, c)
 			if data := parseEvents(events, l, c); data != nil {
-				log.Printf("received historical log. txn hash: %s and event data: %+v", data.TxnHash, data.Data)
+				logger.Debug("received historical log", "event", data.Name, "txn", data.TxnHash.Hex(), "data", data.Data)
 				// Send the event data to the event channel
-				eventCh <- data
+				select {
+				case eventCh <- data:
+				case <-ctx.Done():
+					return nil
+				}
 			}
 		case liveLog := <-subLogs:
+			metrics.LogsReceived.WithLabelValues("live").Inc()
+			if ctl.skip(liveLog.BlockNumber) {
+				metrics.EventsDropped.WithLabelValues("unknown", "paused").Inc()
+				continue
+			}
+			c.upgrade(opts, liveLog)
 			// fmt.Println("\nReceived log from subscription:", liveLog)
 			if data := parseEvents(events, liveLog, c); data != nil {
-				log.Printf("received live log. txn hash: %s and event data: %+v", data.TxnHash, data.Data)
-				eventCh <- data
-			}
-		case stop := <-quit:
-			if stop {
-				return
+				logger.Debug("received live log", "event", data.Name, "txn", data.TxnHash.Hex(), "data", data.Data)
+				select {
+				case eventCh <- data:
+				case <-ctx.Done():
+					return nil
+				}
 			}
 		}
 	}
 
 }
 
+// parseEvents decodes log into an Event if it is one of the requested events. Each log starts
+// a trace whose span context is attached to the Event so it can be followed into the indexer.
 func parseEvents(events []string, log types.Log, c *Contract) *Event {
-	// defensive: ensure topics exist
-	if len(log.Topics) == 0 {
-		return nil
-	}
+	ctx, span := tracer.Start(context.Background(), "subscriber.parseEvents", trace.WithAttributes(
+		attribute.Int64("block", int64(log.BlockNumber)),
+		attribute.String("txn", log.TxHash.Hex()),
+		attribute.Int("log_index", int(log.Index)),
+	))
+	defer span.End()
 
-	name, ok := c.events[log.Topics[0]]
-	if !ok {
-		return nil
-	}
-
-	// ensure requested
-	found := false
-	for _, e := range events {
-		if e == name {
-			found = true
-			break
+	// decode with the ABI of the implementation active at the log's block
+	contractABI, topicEvents := c.at(log.BlockNumber)
+	var (
+		event abi.Event
+		found bool
+		data  map[string]interface{}
+	)
+	decodedBy := DecodedByABI
+	if len(log.Topics) > 0 {
+		if name, ok := topicEvents[log.Topics[0]]; ok {
+			event, found = contractABI.Events[name], true
+		} else if c.fallback {
+			// not in the ABI, try the standard event signatures
+			if entry, ok := lookupSignature(log.Topics); ok {
+				contractABI, decodedBy = entry.abi, DecodedBySignature
+				event, found = entry.abi.Events[entry.name], true
+			}
 		}
 	}
 	if !found {
-		fmt.Println("event not found in requested events")
+		// anonymous events have no topic0, match them by topic count and data layout
+		var err error
+		event, data, err = matchAnonymous(ctx, events, log, contractABI)
+		switch {
+		case errors.Is(err, errAmbiguousAnonymous):
+			logger.Warn("dropping ambiguous anonymous log", "block", log.BlockNumber, "txn", log.TxHash.Hex(), "err", err)
+			metrics.EventsDropped.WithLabelValues("unknown", "ambiguous_anonymous").Inc()
+			return nil
+		case err != nil:
+			metrics.EventsDropped.WithLabelValues("unknown", "unknown_topic").Inc()
+			return nil
+		}
+	}
+	name := event.Name
+
+	if !EventRequested(events, event) {
+		logger.Debug("event not found in requested events", "event", name)
+		metrics.EventsDropped.WithLabelValues(name, "not_requested").Inc()
 		return nil
 	}
 
-	data, err := unpackLog(name, log.Topics, log.Data, c.ABI)
-	if err != nil || data == nil {
+	if !c.passesFilters(event, log.Topics) {
+		metrics.EventsDropped.WithLabelValues(name, "filtered").Inc()
 		return nil
 	}
 
+	span.SetAttributes(
+		attribute.String("event", name),
+		attribute.String("signature", event.Sig),
+		attribute.String("decoded_by", decodedBy))
+	if data == nil {
+		var err error
+		data, err = unpackLog(ctx, name, log.Topics, log.Data, contractABI)
+		if err != nil {
+			recordSpanError(span, err)
+		}
+		if err != nil || data == nil {
+			metrics.EventsDropped.WithLabelValues(name, "decode_error").Inc()
+			return nil
+		}
+	}
 	ev := &Event{
 		Name:        name,
+		Signature:   event.Sig,
 		BlockNumber: log.BlockNumber,
 		TxnHash:     log.TxHash,
+		LogIndex:    log.Index,
 		Contract:    log.Address,
 		Data:        data,
+		Inputs:      event.Inputs,
+		DecodedBy:   decodedBy,
+		SpanContext: span.SpanContext(),
+	}
+	// expressions from the config file drop events and reshape their data
+	chain, err := c.transforms(event)
+	if err == nil && chain != nil {
+		err = chain.apply(ev)
+	}
+	switch {
+	case errors.Is(err, errFiltered):
+		metrics.EventsDropped.WithLabelValues(name, "expression").Inc()
+		return nil
+	case err != nil:
+		recordSpanError(span, err)
+		logger.Warn("failed to evaluate event expressions", "event", name, "txn", log.TxHash.Hex(), "err", err)
+		metrics.EventsDropped.WithLabelValues(name, "expression_error").Inc()
+		return nil
 	}
+	metrics.EventsDecoded.WithLabelValues(name).Inc()
 	// fmt.Println("events parsing done: ", *ev)
 	return ev
 }
 
-func unpackLog(eventName string, topics []common.Hash, data []byte, contractABI abi.ABI) (map[string]interface{}, error) {
+// unpackLog decodes the data and indexed topics of a log into the decoded-value model
+// described in values.go.
+func unpackLog(ctx context.Context, eventName string, topics []common.Hash, data []byte, contractABI abi.ABI) (map[string]interface{}, error) {
+	_, span := tracer.Start(ctx, "subscriber.unpackLog")
+	defer span.End()
+
 	out := make(map[string]interface{})
 
 	ev, ok := contractABI.Events[eventName]
@@ -149,33 +369,42 @@ func unpackLog(eventName string, topics []common.Hash, data []byte, contractABI
 	}
 
 	if len(data) > 0 {
-		if err := contractABI.UnpackIntoMap(out, eventName, data); err != nil {
+		values, err := ev.Inputs.Unpack(data)
+		if err != nil {
 			return nil, err
 		}
+		next := 0
+		for i, input := range ev.Inputs {
+			if input.Indexed {
+				continue
+			}
+			v, err := normalizeValue(input.Type, values[next])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", ArgumentName(input, i), err)
+			}
+			out[ArgumentName(input, i)] = v
+			next++
+		}
 	}
 
-	// collect indexed params from topics (topics[0] is event id)
+	// collect indexed params from topics (topics[0] is event id, unless anonymous)
 	topicIdx := 1
-	for _, input := range ev.Inputs {
+	if ev.Anonymous {
+		topicIdx = 0
+	}
+	for i, input := range ev.Inputs {
 		if !input.Indexed {
 			continue
 		}
+		name := ArgumentName(input, i)
 		if topicIdx >= len(topics) {
-			return nil, fmt.Errorf("missing topic for indexed arg %s", input.Name)
+			return nil, fmt.Errorf("missing topic for indexed arg %s", name)
 		}
-		tb := topics[topicIdx].Bytes()
-		switch input.Type.T {
-		case abi.AddressTy:
-			out[input.Name] = common.BytesToAddress(tb[12:]).Hex()
-		case abi.UintTy, abi.IntTy:
-			out[input.Name] = new(big.Int).SetBytes(tb)
-		case abi.BoolTy:
-			out[input.Name] = tb[len(tb)-1] == 1
-		case abi.BytesTy, abi.StringTy:
-			out[input.Name] = "indexed-hash:" + hex.EncodeToString(tb)
-		default:
-			out[input.Name] = hex.EncodeToString(tb)
+		v, err := decodeTopic(input, topics[topicIdx])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
 		}
+		out[name] = v
 		topicIdx++
 	}
 	// fmt.Println("unpacking log done, output: ", out)
@@ -0,0 +1,475 @@
+package subsrciber
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing APIs supported by CallTracer.
+const (
+	// TraceDebug traces every block with debug_traceBlockByNumber and the callTracer (geth,
+	// Reth, Erigon).
+	TraceDebug = "debug_traceBlockByNumber"
+	// TraceFilter fetches the Parity-style traces touching the addresses with trace_filter
+	// (Erigon, Nethermind, Reth).
+	TraceFilter = "trace_filter"
+)
+
+// tracePollInterval is how often the chain head is checked for new blocks to trace
+const tracePollInterval = 12 * time.Second
+
+// Trace is a frame of the call tree of a transaction: an internal call, a contract creation
+// or a self-destruct, read from the execution trace of its block.
+type Trace struct {
+	TxnHash     common.Hash
+	BlockNumber uint64
+	TxIndex     uint
+	// TraceAddress is the position of the frame in the call tree: empty for the transaction
+	// itself, [0, 2] for the third subcall of its first subcall.
+	TraceAddress []int
+	// Type is CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE, CREATE2 or SELFDESTRUCT.
+	Type string
+	From common.Address
+	// To is the called or created contract, or the beneficiary of a self-destruct.
+	To common.Address
+	// Value is the amount of wei moved by the frame.
+	Value   *big.Int
+	Gas     uint64
+	GasUsed uint64
+	Input   []byte
+	// Error is the failure of the frame, e.g. "execution reverted", empty when it succeeded.
+	Error string
+	// Call is the decoded input of calls to the contract, and of the calls it delegates.
+	Call *Call
+}
+
+// Path returns TraceAddress as dot-separated indexes, e.g. "0.2", empty for the transaction.
+func (t *Trace) Path() string {
+	parts := make([]string, len(t.TraceAddress))
+	for i, n := range t.TraceAddress {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// callFrame is a frame of the geth callTracer output.
+type callFrame struct {
+	Type    string          `json:"type"`
+	From    common.Address  `json:"from"`
+	To      *common.Address `json:"to"`
+	Value   *hexutil.Big    `json:"value"`
+	Gas     hexutil.Uint64  `json:"gas"`
+	GasUsed hexutil.Uint64  `json:"gasUsed"`
+	Input   hexutil.Bytes   `json:"input"`
+	Error   string          `json:"error"`
+	Calls   []callFrame     `json:"calls"`
+}
+
+// txTrace is an element of the debug_traceBlockByNumber result. Nodes older than geth 1.12
+// do not return txHash.
+type txTrace struct {
+	TxHash *common.Hash `json:"txHash"`
+	Result *callFrame   `json:"result"`
+	Error  string       `json:"error"`
+}
+
+// parityTrace is an element of the trace_filter result.
+type parityTrace struct {
+	Action struct {
+		CallType       string          `json:"callType"`
+		CreationMethod string          `json:"creationMethod"`
+		From           common.Address  `json:"from"`
+		To             *common.Address `json:"to"`
+		Value          *hexutil.Big    `json:"value"`
+		Gas            hexutil.Uint64  `json:"gas"`
+		Input          hexutil.Bytes   `json:"input"`
+		Init           hexutil.Bytes   `json:"init"`
+		// self-destruct fields
+		Address       *common.Address `json:"address"`
+		RefundAddress *common.Address `json:"refundAddress"`
+		Balance       *hexutil.Big    `json:"balance"`
+	} `json:"action"`
+	Result *struct {
+		GasUsed hexutil.Uint64  `json:"gasUsed"`
+		Address *common.Address `json:"address"`
+	} `json:"result"`
+	Error               string       `json:"error"`
+	Type                string       `json:"type"`
+	TraceAddress        []int        `json:"traceAddress"`
+	TransactionHash     *common.Hash `json:"transactionHash"`
+	TransactionPosition uint         `json:"transactionPosition"`
+	BlockNumber         uint64       `json:"blockNumber"`
+}
+
+// traceFilterArgs are the parameters of trace_filter.
+type traceFilterArgs struct {
+	FromBlock   hexutil.Uint64   `json:"fromBlock"`
+	ToBlock     hexutil.Uint64   `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress,omitempty"`
+	ToAddress   []common.Address `json:"toAddress,omitempty"`
+}
+
+// CallTracer reads the execution traces of blocks and keeps the frames sent from or to the
+// contract and the extra traced addresses. Ether moved by internal calls and calls made by
+// other contracts emit no log, so they are only visible in traces.
+type CallTracer struct {
+	client    *rpc.Client
+	contract  *Contract
+	method    string
+	addresses []common.Address
+	watched   map[common.Address]bool
+	window    uint64
+}
+
+// NewCallTracer returns a CallTracer for c and the addresses of opts.Traces, using the
+// tracing API set by opts.Traces.Method.
+func NewCallTracer(client *rpc.Client, c *Contract, opts *cli.Config) (*CallTracer, error) {
+	method := opts.Traces.Method
+	if method == "" {
+		method = TraceDebug
+	}
+	if method != TraceDebug && method != TraceFilter {
+		return nil, fmt.Errorf("unknown trace method %q, use %s or %s", method, TraceDebug, TraceFilter)
+	}
+	t := &CallTracer{
+		client:    client,
+		contract:  c,
+		method:    method,
+		addresses: []common.Address{c.Address},
+		watched:   map[common.Address]bool{c.Address: true},
+		window:    uint64(opts.Query.Window),
+	}
+	for _, a := range opts.Traces.Addresses {
+		if !common.IsHexAddress(a) {
+			return nil, fmt.Errorf("invalid traced address %q", a)
+		}
+		addr := common.HexToAddress(a)
+		if !t.watched[addr] {
+			t.watched[addr] = true
+			t.addresses = append(t.addresses, addr)
+		}
+	}
+	if t.window == 0 {
+		t.window = 2000
+	}
+	return t, nil
+}
+
+// Run sends the traces of the blocks in [from, to] to traceCh, in block and call tree order.
+// A from of 0 starts at the chain head and a to of 0 keeps tracing new blocks. It returns nil
+// once to is traced or ctx is done, and the error of the first block that cannot be traced.
+func (t *CallTracer) Run(ctx context.Context, from, to uint64, traceCh chan<- *Trace) error {
+	next := from
+	for {
+		last := to
+		if last == 0 {
+			var head hexutil.Uint64
+			err := t.client.CallContext(ctx, &head, "eth_blockNumber")
+			metrics.ObserveRPC("eth_blockNumber", err)
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case err != nil:
+				logger.Warn("failed to fetch chain head for tracing", "err", err)
+			default:
+				last = uint64(head)
+				if next == 0 {
+					next = last
+				}
+			}
+		}
+
+		for last != 0 && next <= last {
+			end := next
+			if t.method == TraceFilter {
+				end = min(next+t.window-1, last)
+			}
+			traces, err := t.Traces(ctx, next, end)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("failed to trace blocks %d-%d: %w", next, end, err)
+			}
+			logger.Debug("traced blocks", "from", next, "to", end, "traces", len(traces))
+			for _, tr := range traces {
+				select {
+				case traceCh <- tr:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+			next = end + 1
+		}
+		if to != 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(tracePollInterval):
+		}
+	}
+}
+
+// Traces returns the traces of the blocks in [from, to] touching the traced addresses,
+// sorted by block, transaction and position in the call tree.
+func (t *CallTracer) Traces(ctx context.Context, from, to uint64) ([]*Trace, error) {
+	ctx, span := tracer.Start(ctx, "subscriber.trace", trace.WithAttributes(
+		attribute.String("method", t.method), attribute.Int64("from", int64(from)), attribute.Int64("to", int64(to))))
+	defer span.End()
+
+	var traces []*Trace
+	var err error
+	if t.method == TraceFilter {
+		traces, err = t.filterTraces(ctx, from, to)
+	} else {
+		for block := from; block <= to && err == nil; block++ {
+			var blockTraces []*Trace
+			blockTraces, err = t.blockTraces(ctx, block)
+			traces = append(traces, blockTraces...)
+		}
+	}
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	sort.SliceStable(traces, func(i, j int) bool {
+		a, b := traces[i], traces[j]
+		if a.BlockNumber != b.BlockNumber {
+			return a.BlockNumber < b.BlockNumber
+		}
+		if a.TxIndex != b.TxIndex {
+			return a.TxIndex < b.TxIndex
+		}
+		return lessTraceAddress(a.TraceAddress, b.TraceAddress)
+	})
+	for _, tr := range traces {
+		t.decode(tr)
+		metrics.TracesReceived.WithLabelValues(tr.Type).Inc()
+	}
+	span.SetAttributes(attribute.Int("traces", len(traces)))
+	return traces, nil
+}
+
+// blockTraces traces block with the callTracer and flattens the call trees.
+func (t *CallTracer) blockTraces(ctx context.Context, block uint64) ([]*Trace, error) {
+	var result []txTrace
+	err := t.client.CallContext(ctx, &result, TraceDebug, hexutil.Uint64(block), map[string]string{"tracer": "callTracer"})
+	metrics.ObserveRPC(TraceDebug, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []common.Hash
+	for _, tx := range result {
+		if tx.TxHash == nil {
+			if hashes, err = t.blockTransactions(ctx, block); err != nil {
+				return nil, err
+			}
+			if len(hashes) != len(result) {
+				return nil, fmt.Errorf("block %d has %d transactions but %d traces", block, len(hashes), len(result))
+			}
+			break
+		}
+	}
+
+	var traces []*Trace
+	for i, tx := range result {
+		var txHash common.Hash
+		if tx.TxHash != nil {
+			txHash = *tx.TxHash
+		} else {
+			txHash = hashes[i]
+		}
+		if tx.Error != "" {
+			return nil, fmt.Errorf("failed to trace transaction %s: %s", txHash.Hex(), tx.Error)
+		}
+		if tx.Result == nil {
+			continue
+		}
+		t.flatten(tx.Result, nil, func(frame *callFrame, path []int) {
+			tr := &Trace{
+				TxnHash:      txHash,
+				BlockNumber:  block,
+				TxIndex:      uint(i),
+				TraceAddress: path,
+				Type:         strings.ToUpper(frame.Type),
+				From:         frame.From,
+				Value:        new(big.Int),
+				Gas:          uint64(frame.Gas),
+				GasUsed:      uint64(frame.GasUsed),
+				Input:        frame.Input,
+				Error:        frame.Error,
+			}
+			if frame.To != nil {
+				tr.To = *frame.To
+			}
+			if frame.Value != nil {
+				tr.Value = frame.Value.ToInt()
+			}
+			traces = append(traces, tr)
+		})
+	}
+	return traces, nil
+}
+
+// flatten calls keep with every frame of the tree rooted at frame sent from or to a traced
+// address, with its position in the tree.
+func (t *CallTracer) flatten(frame *callFrame, path []int, keep func(*callFrame, []int)) {
+	if t.watched[frame.From] || (frame.To != nil && t.watched[*frame.To]) {
+		keep(frame, append([]int{}, path...))
+	}
+	for i := range frame.Calls {
+		t.flatten(&frame.Calls[i], append(path, i), keep)
+	}
+}
+
+// blockTransactions returns the transaction hashes of block, in order.
+func (t *CallTracer) blockTransactions(ctx context.Context, block uint64) ([]common.Hash, error) {
+	var head *struct {
+		Transactions []common.Hash `json:"transactions"`
+	}
+	err := t.client.CallContext(ctx, &head, "eth_getBlockByNumber", hexutil.Uint64(block), false)
+	metrics.ObserveRPC("eth_getBlockByNumber", err)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, fmt.Errorf("block %d not found", block)
+	}
+	return head.Transactions, nil
+}
+
+// filterTraces fetches the traces sent from and to the traced addresses with trace_filter,
+// one call for each direction since the node matches both lists otherwise.
+func (t *CallTracer) filterTraces(ctx context.Context, from, to uint64) ([]*Trace, error) {
+	seen := make(map[string]bool)
+	var traces []*Trace
+	for _, args := range []traceFilterArgs{
+		{FromBlock: hexutil.Uint64(from), ToBlock: hexutil.Uint64(to), FromAddress: t.addresses},
+		{FromBlock: hexutil.Uint64(from), ToBlock: hexutil.Uint64(to), ToAddress: t.addresses},
+	} {
+		var result []parityTrace
+		err := t.client.CallContext(ctx, &result, TraceFilter, args)
+		metrics.ObserveRPC(TraceFilter, err)
+		if err != nil {
+			return nil, err
+		}
+		for _, pt := range result {
+			tr := newParityTrace(pt)
+			if tr == nil {
+				continue
+			}
+			// a call between two traced addresses is returned by both calls
+			key := tr.TxnHash.Hex() + "/" + tr.Path()
+			if !seen[key] {
+				seen[key] = true
+				traces = append(traces, tr)
+			}
+		}
+	}
+	return traces, nil
+}
+
+// newParityTrace converts a trace_filter trace, nil for block and uncle rewards.
+func newParityTrace(pt parityTrace) *Trace {
+	if pt.TransactionHash == nil {
+		return nil
+	}
+	a := pt.Action
+	tr := &Trace{
+		TxnHash:      *pt.TransactionHash,
+		BlockNumber:  pt.BlockNumber,
+		TxIndex:      pt.TransactionPosition,
+		TraceAddress: pt.TraceAddress,
+		From:         a.From,
+		Value:        new(big.Int),
+		Gas:          uint64(a.Gas),
+		Error:        pt.Error,
+	}
+	if tr.TraceAddress == nil {
+		tr.TraceAddress = []int{}
+	}
+	if a.Value != nil {
+		tr.Value = a.Value.ToInt()
+	}
+	if pt.Result != nil {
+		tr.GasUsed = uint64(pt.Result.GasUsed)
+	}
+
+	switch pt.Type {
+	case "call":
+		tr.Type = strings.ToUpper(a.CallType)
+		tr.Input = a.Input
+		if a.To != nil {
+			tr.To = *a.To
+		}
+	case "create":
+		tr.Type = "CREATE"
+		if a.CreationMethod == "create2" {
+			tr.Type = "CREATE2"
+		}
+		tr.Input = a.Init
+		if pt.Result != nil && pt.Result.Address != nil {
+			tr.To = *pt.Result.Address
+		}
+	case "suicide":
+		tr.Type = "SELFDESTRUCT"
+		if a.Address != nil {
+			tr.From = *a.Address
+		}
+		if a.RefundAddress != nil {
+			tr.To = *a.RefundAddress
+		}
+		if a.Balance != nil {
+			tr.Value = a.Balance.ToInt()
+		}
+	default:
+		return nil
+	}
+	return tr
+}
+
+// decode sets Call for calls to the contract, and for the calls it delegates to its
+// implementation, which carry calldata of the contract ABI.
+func (t *CallTracer) decode(tr *Trace) {
+	switch {
+	case tr.Type == "DELEGATECALL" && tr.From == t.contract.Address:
+	case tr.To != t.contract.Address:
+		return
+	case tr.Type == "CALL" || tr.Type == "STATICCALL" || tr.Type == "CALLCODE":
+	default:
+		return
+	}
+	call, err := t.contract.DecodeCall(tr.BlockNumber, tr.Input)
+	if err != nil {
+		logger.Warn("failed to decode traced call", "txn", tr.TxnHash.Hex(), "trace", tr.Path(), "selector", call.Selector, "err", err)
+	}
+	tr.Call = call
+}
+
+// lessTraceAddress orders frames depth first: a frame before its subcalls, subcalls in order.
+func lessTraceAddress(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
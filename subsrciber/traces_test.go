@@ -0,0 +1,269 @@
+package subsrciber
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+const wethABI = `[
+	{"type":"function","name":"deposit","inputs":[],"outputs":[],"stateMutability":"payable"},
+	{"type":"function","name":"withdraw","inputs":[{"name":"wad","type":"uint256"}],"outputs":[],"stateMutability":"nonpayable"},
+	{"type":"function","name":"transfer","inputs":[{"name":"dst","type":"address"},{"name":"wad","type":"uint256"}],"outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable"},
+	{"type":"function","name":"balanceOf","inputs":[{"name":"","type":"address"}],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"},
+	{"type":"function","name":"approve","inputs":[{"name":"guy","type":"address"},{"name":"wad","type":"uint256"}],"outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable"},
+	{"type":"function","name":"transferFrom","inputs":[{"name":"src","type":"address"},{"name":"dst","type":"address"},{"name":"wad","type":"uint256"}],"outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable"}
+]`
+
+var wethAddress = common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2")
+
+// expectedTrace is a frame of the testdata fixtures. Both tracing methods yield the same
+// frames, except for the reverted withdrawal, reported differently by each node format.
+type expectedTrace struct {
+	block  uint64
+	txn    string
+	path   string
+	typ    string
+	value  string
+	method string
+	args   map[string]string
+}
+
+var expectedTraces = []expectedTrace{
+	// a router swap: deposit, transfer to the pair, then the pair reads its WETH balance
+	{block: 21000000, txn: "0xa1a1", path: "0", typ: "CALL", value: "1000000000000000000", method: "deposit", args: map[string]string{}},
+	{block: 21000000, txn: "0xa1a1", path: "1", typ: "CALL", value: "0", method: "transfer",
+		args: map[string]string{"dst": "0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc", "wad": "1000000000000000000"}},
+	{block: 21000000, txn: "0xa1a1", path: "2.2", typ: "STATICCALL", value: "0", method: "balanceOf",
+		args: map[string]string{"arg0": "0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc"}},
+	// a withdrawal and the ether paid back by WETH, which has no calldata to decode
+	{block: 21000000, txn: "0xb2b2", path: "", typ: "CALL", value: "0", method: "withdraw", args: map[string]string{"wad": "500000000000000000"}},
+	{block: 21000000, txn: "0xb2b2", path: "0", typ: "CALL", value: "500000000000000000"},
+	// a reverted withdrawal and a plain ether deposit
+	{block: 21000001, txn: "0xd4d4", path: "", typ: "CALL", value: "0", method: "withdraw", args: map[string]string{"wad": "1000000000000000000000"}},
+	{block: 21000001, txn: "0xe5e5", path: "", typ: "CALL", value: "1000000000000000000", method: ""},
+}
+
+func replayTracer(t *testing.T, method, fixtures string) *CallTracer {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(wethABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := cli.Defaults()
+	opts.Traces.Method = method
+	opts.Traces.Fixtures = fixtures
+	client, err := DialTracer(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	tracer, err := NewCallTracer(client, &Contract{Address: wethAddress, ABI: parsed}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracer
+}
+
+func TestTracesFixtures(t *testing.T) {
+	for _, tc := range []struct {
+		method   string
+		fixtures string
+		// revert and revertGas are the error and gas used of the reverted withdrawal
+		revert    string
+		revertGas uint64
+	}{
+		{TraceDebug, "testdata/traces_debug.json", "execution reverted", 24000},
+		{TraceFilter, "testdata/traces_parity.json", "Reverted", 0},
+	} {
+		t.Run(tc.method, func(t *testing.T) {
+			traces, err := replayTracer(t, tc.method, tc.fixtures).Traces(context.Background(), 21000000, 21000001)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(traces) != len(expectedTraces) {
+				t.Fatalf("got %d traces, want %d", len(traces), len(expectedTraces))
+			}
+			for i, want := range expectedTraces {
+				tr := traces[i]
+				got := expectedTrace{
+					block: tr.BlockNumber,
+					txn:   tr.TxnHash.Hex()[:6],
+					path:  tr.Path(),
+					typ:   tr.Type,
+					value: tr.Value.String(),
+				}
+				if tr.Call != nil {
+					got.method = tr.Call.Method
+					got.args = make(map[string]string, len(tr.Call.Args))
+					for k, v := range tr.Call.Args {
+						got.args[k] = fmt.Sprint(v)
+					}
+				}
+				if fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("trace %d:\n got %+v\nwant %+v", i, got, want)
+				}
+			}
+
+			if tr := traces[5]; tr.Error != tc.revert || tr.GasUsed != tc.revertGas {
+				t.Errorf("reverted withdrawal: got error %q, gas used %d", tr.Error, tr.GasUsed)
+			}
+			for i, tr := range traces {
+				if i != 5 && tr.Error != "" {
+					t.Errorf("trace %d: unexpected error %q", i, tr.Error)
+				}
+			}
+			// calls to the contract are decoded, the ether WETH sends back is not
+			if traces[4].From != wethAddress || traces[4].Call != nil {
+				t.Errorf("ether payout: from %s, call %+v", traces[4].From.Hex(), traces[4].Call)
+			}
+			if call := traces[6].Call; call == nil || call.Selector != "" {
+				t.Errorf("plain ether deposit: got call %+v, want one without selector", call)
+			}
+		})
+	}
+}
+
+func TestTracesRun(t *testing.T) {
+	tracer := replayTracer(t, TraceDebug, "testdata/traces_debug.json")
+	traceCh := make(chan *Trace, len(expectedTraces))
+	if err := tracer.Run(context.Background(), 21000000, 21000001, traceCh); err != nil {
+		t.Fatal(err)
+	}
+	close(traceCh)
+	var n int
+	for tr := range traceCh {
+		if want := expectedTraces[n]; tr.BlockNumber != want.block || tr.Path() != want.path {
+			t.Errorf("trace %d: got block %d path %q", n, tr.BlockNumber, tr.Path())
+		}
+		n++
+	}
+	if n != len(expectedTraces) {
+		t.Errorf("got %d traces, want %d", n, len(expectedTraces))
+	}
+
+	// blocks missing from the fixtures fail like an unavailable node
+	err := tracer.Run(context.Background(), 22000000, 22000000, make(chan *Trace, 1))
+	if err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Errorf("got %v, want a missing fixture error", err)
+	}
+}
+
+func TestTracePath(t *testing.T) {
+	for _, tc := range []struct {
+		address []int
+		want    string
+	}{
+		{nil, ""},
+		{[]int{0}, "0"},
+		{[]int{0, 2, 10}, "0.2.10"},
+	} {
+		if got := (&Trace{TraceAddress: tc.address, Value: new(big.Int)}).Path(); got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.address, got, tc.want)
+		}
+	}
+}
+
+// recordedRange returns the tracing method and block range of a recording, read from its
+// exchanges.
+func recordedRange(t *testing.T, exchanges []fixtureExchange) (method string, from, to uint64) {
+	t.Helper()
+	for _, ex := range exchanges {
+		var first, last uint64
+		switch ex.Method {
+		case TraceDebug:
+			var params []json.RawMessage
+			var block hexutil.Uint64
+			if err := json.Unmarshal(ex.Params, &params); err != nil || len(params) == 0 || json.Unmarshal(params[0], &block) != nil {
+				t.Fatalf("invalid %s params %s", ex.Method, ex.Params)
+			}
+			first, last = uint64(block), uint64(block)
+		case TraceFilter:
+			var params []traceFilterArgs
+			if err := json.Unmarshal(ex.Params, &params); err != nil || len(params) == 0 {
+				t.Fatalf("invalid %s params %s", ex.Method, ex.Params)
+			}
+			first, last = uint64(params[0].FromBlock), uint64(params[0].ToBlock)
+		default:
+			continue
+		}
+		if method == "" || first < from {
+			from = first
+		}
+		if method == "" || last > to {
+			to = last
+		}
+		method = ex.Method
+	}
+	if method == "" {
+		t.Fatal("no tracing exchange in the recording")
+	}
+	return method, from, to
+}
+
+// TestTracesRecorded replays the exchanges recorded from a mainnet node with TRACE_RECORD
+// (testdata/recorded_*.json, see the README) and checks the frames against the recorded
+// node output rather than hand-written expectations.
+func TestTracesRecorded(t *testing.T) {
+	files, err := filepath.Glob("testdata/recorded_*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Skip("no recorded trace fixtures in testdata")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			exchanges, err := readFixtures(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			method, from, to := recordedRange(t, exchanges)
+			traces, err := replayTracer(t, method, file).Traces(context.Background(), from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(traces) == 0 {
+				t.Fatalf("no traces in blocks %d-%d", from, to)
+			}
+
+			var decoded int
+			for i, tr := range traces {
+				if tr.BlockNumber < from || tr.BlockNumber > to {
+					t.Errorf("trace %d: block %d outside %d-%d", i, tr.BlockNumber, from, to)
+				}
+				if tr.From != wethAddress && tr.To != wethAddress {
+					t.Errorf("trace %d (%s %s): does not touch WETH", i, tr.TxnHash.Hex(), tr.Path())
+				}
+				if i > 0 {
+					prev := traces[i-1]
+					if prev.BlockNumber > tr.BlockNumber || prev.BlockNumber == tr.BlockNumber && (prev.TxIndex > tr.TxIndex ||
+						prev.TxIndex == tr.TxIndex && !lessTraceAddress(prev.TraceAddress, tr.TraceAddress)) {
+						t.Errorf("trace %d (%s %s) is out of order", i, tr.TxnHash.Hex(), tr.Path())
+					}
+				}
+				if tr.To == wethAddress && tr.Type != "DELEGATECALL" && tr.Call == nil {
+					t.Errorf("trace %d (%s %s): call to WETH not decoded", i, tr.TxnHash.Hex(), tr.Path())
+				}
+				if tr.Call != nil && tr.Call.Method != "" {
+					decoded++
+					if len(tr.Call.Args) != len(tr.Call.Inputs) {
+						t.Errorf("trace %d: %s decoded %d of %d arguments", i, tr.Call.Signature, len(tr.Call.Args), len(tr.Call.Inputs))
+					}
+				}
+			}
+			if decoded == 0 {
+				t.Error("no call to WETH decoded")
+			}
+		})
+	}
+}
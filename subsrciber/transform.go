@@ -0,0 +1,440 @@
+package subsrciber
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+// errFiltered is returned by transform when an expression filter drops the event.
+var errFiltered = errors.New("event dropped by filter expression")
+
+// Decimal is a decimal number computed by an expression, e.g. by units(value, 6). It is
+// stored as NUMERIC and served as a string like uint256 values.
+type Decimal string
+
+// logInfo exposes the log metadata to expressions as `log`, e.g. log.blockNumber. An event
+// argument named log takes precedence.
+type logInfo struct {
+	Event       string `expr:"event"`
+	BlockNumber uint64 `expr:"blockNumber"`
+	TxnHash     string `expr:"txnHash"`
+	LogIndex    uint   `expr:"logIndex"`
+	Contract    string `expr:"contract"`
+}
+
+// compiledTransform is one cli.EventTransform compiled for the argument types of an event.
+type compiledTransform struct {
+	filter *vm.Program
+	fields []compiledField
+	rename []cli.FieldRename
+}
+
+type compiledField struct {
+	name    string
+	program *vm.Program
+	typ     abi.Type
+}
+
+// transformChain is every transform applying to an event, in config order, and the event
+// arguments once transformed.
+type transformChain struct {
+	steps  []compiledTransform
+	inputs abi.Arguments
+}
+
+var (
+	bigIntType  = reflect.TypeOf((*big.Int)(nil))
+	decimalType = reflect.TypeOf(Decimal(""))
+)
+
+// exprOptions are the helpers available to expressions. Integers are *big.Int, comparisons
+// between them and number literals are overloaded, and with exactLiterals the compared
+// literals are parsed from their text, so "value > 1e24" is exact.
+func exprOptions() []expr.Option {
+	cmpTypes := []interface{}{
+		new(func(*big.Int, *big.Int) bool),
+		new(func(*big.Int, int) bool),
+		new(func(int, *big.Int) bool),
+		new(func(*big.Int, float64) bool),
+		new(func(float64, *big.Int) bool),
+	}
+	opts := []expr.Option{
+		expr.Function("units", func(params ...interface{}) (interface{}, error) {
+			return units(params[0], params[1].(int))
+		}, new(func(*big.Int, int) Decimal), new(func(int, int) Decimal)),
+		expr.Function("num", func(params ...interface{}) (interface{}, error) {
+			f, _ := bigFloat(params[0]).Float64()
+			return f, nil
+		}, new(func(*big.Int) float64)),
+		expr.Function("bigint", func(params ...interface{}) (interface{}, error) {
+			n, ok := new(big.Int).SetString(params[0].(string), 0)
+			if !ok {
+				return nil, fmt.Errorf("invalid integer %q", params[0])
+			}
+			return n, nil
+		}, new(func(string) *big.Int)),
+	}
+	for op, name := range map[string]string{"==": "bigEq", "!=": "bigNe", "<": "bigLt", "<=": "bigLe", ">": "bigGt", ">=": "bigGe"} {
+		op := op
+		opts = append(opts,
+			expr.Function(name, func(params ...interface{}) (interface{}, error) {
+				c := bigFloat(params[0]).Cmp(bigFloat(params[1]))
+				switch op {
+				case "==":
+					return c == 0, nil
+				case "!=":
+					return c != 0, nil
+				case "<":
+					return c < 0, nil
+				case "<=":
+					return c <= 0, nil
+				case ">":
+					return c > 0, nil
+				}
+				return c >= 0, nil
+			}, cmpTypes...),
+			expr.Operator(op, name))
+	}
+	return opts
+}
+
+// exactLiterals replaces the number literals compared in source, which expr parses as float64
+// (1e24 is 999999999999999983222784), with the exact integer of their text. Other literals,
+// e.g. in num(value) / 1e18, stay floats.
+func exactLiterals(source string) expr.Option {
+	return expr.Patch(literalPatcher{source: []rune(source)})
+}
+
+type literalPatcher struct {
+	source []rune
+}
+
+// Visit implements ast.Visitor.
+func (p literalPatcher) Visit(node *ast.Node) {
+	n, ok := (*node).(*ast.BinaryNode)
+	if !ok {
+		return
+	}
+	switch n.Operator {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.patch(&n.Left)
+		p.patch(&n.Right)
+	}
+}
+
+func (p literalPatcher) patch(node *ast.Node) {
+	if _, ok := (*node).(*ast.FloatNode); !ok {
+		return
+	}
+	loc := (*node).Location()
+	if loc.From < 0 || loc.To > len(p.source) || loc.From >= loc.To {
+		return
+	}
+	r, ok := new(big.Rat).SetString(strings.ReplaceAll(string(p.source[loc.From:loc.To]), "_", ""))
+	if !ok || !r.IsInt() {
+		return
+	}
+	ast.Patch(node, &ast.ConstantNode{Value: new(big.Int).Set(r.Num())})
+}
+
+// bigFloat converts an expression number to a big.Float precise enough for uint256.
+func bigFloat(v interface{}) *big.Float {
+	f := new(big.Float).SetPrec(512)
+	switch n := v.(type) {
+	case *big.Int:
+		return f.SetInt(n)
+	case int:
+		return f.SetInt64(int64(n))
+	case float64:
+		return f.SetFloat64(n)
+	}
+	return f
+}
+
+// units formats x / 10^decimals as an exact decimal, e.g. units(1500000, 6) is "1.5".
+func units(v interface{}, decimals int) (Decimal, error) {
+	x, err := toBigInt(v)
+	if err != nil {
+		return "", err
+	}
+	if decimals < 0 {
+		return "", fmt.Errorf("negative decimals %d", decimals)
+	}
+	s := new(big.Int).Abs(x).String()
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	whole, frac := s[:len(s)-decimals], strings.TrimRight(s[len(s)-decimals:], "0")
+	if frac != "" {
+		whole += "." + frac
+	}
+	if x.Sign() < 0 {
+		whole = "-" + whole
+	}
+	return Decimal(whole), nil
+}
+
+// exprEnv returns the variables of an event with the types of its decoded values.
+func exprEnv(inputs abi.Arguments) map[string]interface{} {
+	env := map[string]interface{}{"log": logInfo{}}
+	for i, in := range inputs {
+		env[ArgumentName(in, i)] = envValue(in)
+	}
+	return env
+}
+
+// envValue returns a zero value of the type arg decodes to in the decoded-value model.
+func envValue(arg abi.Argument) interface{} {
+	switch arg.Type.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		if arg.Indexed {
+			return ""
+		}
+	}
+	switch arg.Type.T {
+	case abi.IntTy, abi.UintTy:
+		return new(big.Int)
+	case abi.BoolTy:
+		return false
+	case abi.FixedPointTy:
+		return Decimal("")
+	case abi.SliceTy, abi.ArrayTy:
+		return []interface{}{}
+	case abi.TupleTy:
+		return map[string]interface{}{}
+	}
+	return ""
+}
+
+// derivedType returns the ABI type a derived field is stored with for the result type of
+// its expression. Decimals and floats are fixed point numbers, anything else is text.
+func derivedType(t reflect.Type) abi.Type {
+	if t == nil {
+		return abi.Type{T: abi.StringTy}
+	}
+	switch {
+	case t == decimalType:
+		return abi.Type{T: abi.FixedPointTy}
+	case t == bigIntType:
+		return abi.Type{T: abi.IntTy, Size: 256}
+	}
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return abi.Type{T: abi.FixedPointTy}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return abi.Type{T: abi.IntTy, Size: 256}
+	case reflect.Bool:
+		return abi.Type{T: abi.BoolTy}
+	}
+	return abi.Type{T: abi.StringTy}
+}
+
+// derivedValue converts the result of a derived field expression to the value model of typ.
+func derivedValue(typ abi.Type, v interface{}) (interface{}, error) {
+	switch typ.T {
+	case abi.IntTy:
+		return toBigInt(v)
+	case abi.FixedPointTy:
+		switch n := v.(type) {
+		case Decimal:
+			return n, nil
+		case float64:
+			return Decimal(strconv.FormatFloat(n, 'f', -1, 64)), nil
+		case float32:
+			return Decimal(strconv.FormatFloat(float64(n), 'f', -1, 32)), nil
+		}
+	case abi.StringTy:
+		switch v.(type) {
+		case string, []interface{}, map[string]interface{}, nil:
+			// arrays and maps are stored as JSON text
+			return v, nil
+		}
+		return fmt.Sprint(JSONValue(v)), nil
+	}
+	return v, nil
+}
+
+// compileTransforms compiles the transforms selecting e, each against the arguments left by
+// the previous one. It returns nil when no transform applies to e.
+func compileTransforms(transforms []cli.EventTransform, e abi.Event) (*transformChain, error) {
+	var chain *transformChain
+	for _, t := range transforms {
+		if !EventRequested([]string{t.Event}, e) {
+			continue
+		}
+		if chain == nil {
+			// name every argument so derived fields do not shift the arg<i> names
+			chain = &transformChain{inputs: make(abi.Arguments, len(e.Inputs))}
+			for i, in := range e.Inputs {
+				in.Name = ArgumentName(in, i)
+				chain.inputs[i] = in
+			}
+		}
+		step, inputs, err := compileTransform(t, chain.inputs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Sig, err)
+		}
+		chain.steps = append(chain.steps, step)
+		chain.inputs = inputs
+	}
+	return chain, nil
+}
+
+// compileTransform compiles t for an event with the given arguments and returns the
+// arguments of the transformed event.
+func compileTransform(t cli.EventTransform, inputs abi.Arguments) (compiledTransform, abi.Arguments, error) {
+	var step compiledTransform
+	env := exprEnv(inputs)
+	opts := append(exprOptions(), expr.Env(env))
+
+	if t.Filter != "" {
+		program, err := expr.Compile(t.Filter, append(opts, expr.AsBool(), exactLiterals(t.Filter))...)
+		if err != nil {
+			return step, nil, fmt.Errorf("filter: %w", err)
+		}
+		step.filter = program
+	}
+
+	out := append(abi.Arguments{}, inputs...)
+	for _, f := range t.Fields {
+		if f.Name == "" {
+			return step, nil, fmt.Errorf("derived field without a name")
+		}
+		if _, exists := env[f.Name]; exists {
+			return step, nil, fmt.Errorf("derived field %s: field already exists", f.Name)
+		}
+		program, err := expr.Compile(f.Expr, append(opts, exactLiterals(f.Expr))...)
+		if err != nil {
+			return step, nil, fmt.Errorf("derived field %s: %w", f.Name, err)
+		}
+		typ := derivedType(program.Node().Type())
+		step.fields = append(step.fields, compiledField{name: f.Name, program: program, typ: typ})
+		out = append(out, abi.Argument{Name: f.Name, Type: typ})
+	}
+
+	for _, r := range t.Rename {
+		from, to := -1, -1
+		for i, in := range out {
+			switch in.Name {
+			case r.From:
+				from = i
+			case r.To:
+				to = i
+			}
+		}
+		switch {
+		case from < 0:
+			return step, nil, fmt.Errorf("rename %s: no such field", r.From)
+		case to >= 0 || r.To == "":
+			return step, nil, fmt.Errorf("rename %s: invalid or existing name %q", r.From, r.To)
+		}
+		out[from].Name = r.To
+		step.rename = append(step.rename, r)
+	}
+	return step, out, nil
+}
+
+// apply runs the chain on the decoded data of ev, replacing its data and arguments. It
+// returns errFiltered when a filter drops the event.
+func (chain *transformChain) apply(ev *Event) error {
+	data := ev.Data
+	for _, step := range chain.steps {
+		env := map[string]interface{}{"log": logInfo{
+			Event:       ev.Name,
+			BlockNumber: ev.BlockNumber,
+			TxnHash:     ev.TxnHash.Hex(),
+			LogIndex:    ev.LogIndex,
+			Contract:    ev.Contract.Hex(),
+		}}
+		for k, v := range data {
+			env[k] = v
+		}
+
+		if step.filter != nil {
+			keep, err := expr.Run(step.filter, env)
+			if err != nil {
+				return fmt.Errorf("filter: %w", err)
+			}
+			if keep != true {
+				return errFiltered
+			}
+		}
+
+		out := make(map[string]interface{}, len(data)+len(step.fields))
+		for k, v := range data {
+			out[k] = v
+		}
+		for _, f := range step.fields {
+			v, err := expr.Run(f.program, env)
+			if err != nil {
+				return fmt.Errorf("derived field %s: %w", f.name, err)
+			}
+			if out[f.name], err = derivedValue(f.typ, v); err != nil {
+				return fmt.Errorf("derived field %s: %w", f.name, err)
+			}
+		}
+		for _, r := range step.rename {
+			out[r.To] = out[r.From]
+			delete(out, r.From)
+		}
+		data = out
+	}
+	ev.Data, ev.Inputs = data, chain.inputs
+	return nil
+}
+
+// transforms returns the compiled transforms of e, compiling them on first use since proxy
+// upgrades and the signature fallback bring events with new layouts.
+func (c *Contract) transforms(e abi.Event) (*transformChain, error) {
+	if len(c.exprs) == 0 {
+		return nil, nil
+	}
+	key := e.String()
+	if chain, ok := c.compiled[key]; ok {
+		return chain, nil
+	}
+	chain, err := compileTransforms(c.exprs, e)
+	if err != nil {
+		return nil, err
+	}
+	if c.compiled == nil {
+		c.compiled = make(map[string]*transformChain)
+	}
+	c.compiled[key] = chain
+	return chain, nil
+}
+
+// checkTransforms compiles the transforms for every requested event, so configuration
+// errors are reported at startup. Every transform must select a requested event.
+func (c *Contract) checkTransforms(events []string) error {
+	candidates := c.requestedEvents(events)
+	for _, t := range c.exprs {
+		matched := false
+		for _, e := range candidates {
+			if EventRequested([]string{t.Event}, e) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("event %s in config file is not requested", t.Event)
+		}
+	}
+	for _, e := range candidates {
+		if _, err := c.transforms(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
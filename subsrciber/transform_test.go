@@ -0,0 +1,215 @@
+package subsrciber
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/naman1402/geth-indexer/cli"
+)
+
+var (
+	senderAddress    = common.HexToAddress("0x000000000000000000000000000000000000000a")
+	recipientAddress = common.HexToAddress("0x000000000000000000000000000000000000000b")
+)
+
+func transferEvent(t *testing.T) abi.Event {
+	t.Helper()
+	return signaturesABI(t, "Transfer(address indexed from, address indexed to, uint256 value)").Events["Transfer"]
+}
+
+// decodedTransfer returns a Transfer event of value as decoded by the subscriber.
+func decodedTransfer(e abi.Event, from, to common.Address, value *big.Int) *Event {
+	return &Event{
+		Name:        e.Name,
+		Signature:   e.Sig,
+		BlockNumber: 100,
+		Inputs:      e.Inputs,
+		Data:        map[string]interface{}{"from": from.Hex(), "to": to.Hex(), "value": value},
+	}
+}
+
+// applyTransforms compiles transforms for e and runs them on ev.
+func applyTransforms(t *testing.T, e abi.Event, ev *Event, transforms ...cli.EventTransform) error {
+	t.Helper()
+	chain, err := compileTransforms(transforms, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain.apply(ev)
+}
+
+func TestTransformFilter(t *testing.T) {
+	e := transferEvent(t)
+	for _, tc := range []struct {
+		filter string
+		value  string
+		from   common.Address
+		keep   bool
+	}{
+		// 1e24 as a float64 is 999999999999999983222784, the literal is compared exactly
+		{"value > 1e24", "1000000000000000000000000", senderAddress, false},
+		{"value > 1e24", "1000000000000000000000001", senderAddress, true},
+		{"value > 1e24", "999999999999999983222785", senderAddress, false},
+		{"value >= 1e24", "1000000000000000000000000", senderAddress, true},
+		{"1e24 < value", "1000000000000000000000001", senderAddress, true},
+		{"value == 1_000_000", "1000000", senderAddress, true},
+		{"value != 1000000", "1000000", senderAddress, false},
+		{`value > bigint("1000000000000000000000000")`, "1000000000000000000000000", senderAddress, false},
+		// non-integer literals stay floats
+		{"value > 1.5", "2", senderAddress, true},
+		{"value < 1.5", "2", senderAddress, false},
+		{"num(value) / 1e18 >= 0.5", "500000000000000000", senderAddress, true},
+		{"from != to && value > 0", "1", recipientAddress, false},
+		{"from != to && value > 0", "1", senderAddress, true},
+		{"log.blockNumber >= 100 && log.event == 'Transfer'", "1", senderAddress, true},
+	} {
+		value, _ := new(big.Int).SetString(tc.value, 10)
+		ev := decodedTransfer(e, tc.from, recipientAddress, value)
+		err := applyTransforms(t, e, ev, cli.EventTransform{Event: "Transfer", Filter: tc.filter})
+		switch {
+		case err != nil && !errors.Is(err, errFiltered):
+			t.Errorf("%s on %s: %v", tc.filter, tc.value, err)
+		case (err == nil) != tc.keep:
+			t.Errorf("%s on %s: got kept %t, want %t", tc.filter, tc.value, err == nil, tc.keep)
+		}
+	}
+}
+
+func TestUnits(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		decimals int
+		want     Decimal
+	}{
+		{"1500000", 6, "1.5"},
+		{"1000000", 6, "1"},
+		{"1", 18, "0.000000000000000001"},
+		{"0", 18, "0"},
+		{"1000000000000000000000000", 18, "1000000"},
+		{"-1500000", 6, "-1.5"},
+		{"123", 0, "123"},
+	} {
+		value, _ := new(big.Int).SetString(tc.value, 10)
+		if got, err := units(value, tc.decimals); err != nil || got != tc.want {
+			t.Errorf("units(%s, %d): got %q, %v, want %q", tc.value, tc.decimals, got, err, tc.want)
+		}
+	}
+	if _, err := units(big.NewInt(1), -1); err == nil {
+		t.Error("negative decimals: want an error")
+	}
+}
+
+func TestTransformFields(t *testing.T) {
+	e := transferEvent(t)
+	chain, err := compileTransforms([]cli.EventTransform{
+		{
+			Event: "Transfer",
+			Fields: []cli.DerivedField{
+				{Name: "amount", Expr: "units(value, 6)"},
+				{Name: "ether", Expr: "num(value) / 1e6"},
+				{Name: "route", Expr: `from + "->" + to`},
+				{Name: "large", Expr: "value > 1e6"},
+			},
+			Rename: []cli.FieldRename{{From: "value", To: "raw"}},
+		},
+		// later transforms see the fields of the earlier ones
+		{Event: "Transfer(address,address,uint256)", Filter: "raw > 0 && large", Rename: []cli.FieldRename{{From: "amount", To: "usdc"}}},
+	}, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := decodedTransfer(e, senderAddress, recipientAddress, big.NewInt(1500000))
+	if err := chain.apply(ev); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"from":  senderAddress.Hex(),
+		"to":    recipientAddress.Hex(),
+		"raw":   big.NewInt(1500000),
+		"usdc":  Decimal("1.5"),
+		"ether": Decimal("1.5"),
+		"route": senderAddress.Hex() + "->" + recipientAddress.Hex(),
+		"large": true,
+	}
+	if !reflect.DeepEqual(ev.Data, want) {
+		t.Errorf("got data %v, want %v", ev.Data, want)
+	}
+
+	// derived fields become columns typed after their expression
+	wantColumns := []struct {
+		name string
+		typ  byte
+	}{
+		{"from", abi.AddressTy}, {"to", abi.AddressTy}, {"raw", abi.UintTy},
+		{"usdc", abi.FixedPointTy}, {"ether", abi.FixedPointTy}, {"route", abi.StringTy}, {"large", abi.BoolTy},
+	}
+	if len(ev.Inputs) != len(wantColumns) {
+		t.Fatalf("got %d columns, want %d", len(ev.Inputs), len(wantColumns))
+	}
+	for i, want := range wantColumns {
+		if in := ev.Inputs[i]; in.Name != want.name || in.Type.T != want.typ {
+			t.Errorf("column %d: got %s of type %d, want %s of type %d", i, in.Name, in.Type.T, want.name, want.typ)
+		}
+	}
+	// the ABI event itself is left untouched
+	if e.Inputs[2].Name != "value" || len(e.Inputs) != 3 {
+		t.Errorf("transforms changed the ABI event: %v", e.Inputs)
+	}
+
+	// a filter of the second transform drops the event after the first one ran
+	ev = decodedTransfer(e, senderAddress, recipientAddress, big.NewInt(0))
+	if err := chain.apply(ev); !errors.Is(err, errFiltered) {
+		t.Errorf("got %v, want the event filtered", err)
+	}
+}
+
+func TestCompileTransformsErrors(t *testing.T) {
+	e := transferEvent(t)
+	for _, tc := range []struct {
+		name      string
+		transform cli.EventTransform
+		want      string
+	}{
+		{"syntax error", cli.EventTransform{Filter: "value >"}, "filter: unexpected token"},
+		{"unknown field", cli.EventTransform{Filter: "amount > 1"}, "filter: unknown name amount"},
+		{"filter not returning a bool", cli.EventTransform{Filter: "value"}, "filter: expected bool"},
+		{"unknown function", cli.EventTransform{Fields: []cli.DerivedField{{Name: "x", Expr: "decimals(value)"}}},
+			"derived field x: unknown name decimals"},
+		{"derived field without a name", cli.EventTransform{Fields: []cli.DerivedField{{Expr: "1"}}},
+			"derived field without a name"},
+		{"derived field shadowing an argument", cli.EventTransform{Fields: []cli.DerivedField{{Name: "value", Expr: "1"}}},
+			"derived field value: field already exists"},
+		{"rename of a missing field", cli.EventTransform{Rename: []cli.FieldRename{{From: "amount", To: "x"}}},
+			"rename amount: no such field"},
+		{"rename to an existing field", cli.EventTransform{Rename: []cli.FieldRename{{From: "from", To: "to"}}},
+			`rename from: invalid or existing name "to"`},
+		{"rename to nothing", cli.EventTransform{Rename: []cli.FieldRename{{From: "from"}}},
+			`rename from: invalid or existing name ""`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.transform.Event = "Transfer"
+			_, err := compileTransforms([]cli.EventTransform{tc.transform}, e)
+			if err == nil || !strings.HasPrefix(err.Error(), e.Sig+": "+tc.want) {
+				t.Errorf("got %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	// transforms of other events leave the event alone
+	if chain, err := compileTransforms([]cli.EventTransform{{Event: "Approval", Filter: "nope >"}}, e); chain != nil || err != nil {
+		t.Errorf("got %v, %v for a transform of another event", chain, err)
+	}
+
+	// errors at run time fail the event rather than dropping it
+	ev := decodedTransfer(e, senderAddress, recipientAddress, big.NewInt(1))
+	err := applyTransforms(t, e, ev, cli.EventTransform{Event: "Transfer", Filter: `value > bigint("x")`})
+	if err == nil || errors.Is(err, errFiltered) {
+		t.Errorf("got %v, want a filter error", err)
+	}
+}
@@ -1,24 +1,57 @@
 package subsrciber
 
 import (
+	"sync"
+
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/naman1402/geth-indexer/cli"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Contract struct {
+	// mu guards the ABI timeline, written by the subscriber and read by DecodeCall.
+	mu      sync.RWMutex
 	Address common.Address
-	ABI     abi.ABI
-	events  map[common.Hash]string
+	// ABI is the current ABI, active from block since on.
+	ABI    abi.ABI
+	events map[common.Hash]string
+
+	// Proxy upgrade timeline: implementation is the current one and history holds the
+	// ABIs of earlier implementations, ordered by block.
+	since          uint64
+	implementation common.Address
+	history        []abiVersion
+
+	// fallback enables decoding logs missing from the ABI with the signature registry.
+	fallback bool
+	// filters restrict indexed arguments of the requested events, see filters.go.
+	filters []topicFilter
+	// exprs filter and reshape decoded events, compiled per event layout, see transform.go.
+	exprs    []cli.EventTransform
+	compiled map[string]*transformChain
 }
 
 // Event represents an Ethereum event with its name, block number, block hash, contract address, and event data.
 type Event struct {
-	Name        string
+	// Name is the ABI name of the event, overloads are suffixed ("Transfer0").
+	Name string
+	// Signature is the canonical signature, e.g. "Transfer(address,address,uint256)".
+	Signature   string
 	BlockNumber uint64
 	// BlockHash  common.Hash
 	TxnHash  common.Hash
+	LogIndex uint
 	Contract common.Address
-	Data     map[string]interface{}
+	// Inputs are the ABI arguments the event was decoded with.
+	Inputs abi.Arguments
+	Data   map[string]interface{}
+	// DecodedBy is DecodedByABI or DecodedBySignature.
+	DecodedBy string
+	// Tx is the transaction that logged the event, set by an Enricher.
+	Tx *Transaction
+	// SpanContext identifies the trace started when the log was decoded.
+	SpanContext trace.SpanContext
 }
 
 type EtherscanResponse struct {
@@ -0,0 +1,272 @@
+package subsrciber
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/metrics"
+)
+
+// upgradedTopic is the topic0 of Upgraded(address indexed implementation), emitted by
+// EIP-1967 and UUPS proxies whenever their implementation changes.
+var upgradedTopic = crypto.Keccak256Hash([]byte("Upgraded(address)"))
+
+// abiVersion is the ABI of one implementation of a proxy, active from fromBlock until the
+// next upgrade.
+type abiVersion struct {
+	fromBlock      uint64
+	implementation common.Address
+	abi            abi.ABI
+	events         map[common.Hash]string
+}
+
+func newABIVersion(from uint64, implementation common.Address, parsed abi.ABI) abiVersion {
+	return abiVersion{fromBlock: from, implementation: implementation, abi: parsed, events: eventTopics(parsed)}
+}
+
+// at returns the ABI and topic mapping that were active at block. Logs older than the
+// first known upgrade are decoded with the oldest ABI.
+func (c *Contract) at(block uint64) (abi.ABI, map[common.Hash]string) {
+	if len(c.history) == 0 || block >= c.since {
+		return c.ABI, c.events
+	}
+	i := sort.Search(len(c.history), func(i int) bool { return c.history[i].fromBlock > block }) - 1
+	if i < 0 {
+		i = 0
+	}
+	return c.history[i].abi, c.history[i].events
+}
+
+// topics returns the topic0 of every event in the ABI timeline, plus Upgraded.
+func (c *Contract) topics() []common.Hash {
+	seen := map[common.Hash]bool{upgradedTopic: true}
+	topics := []common.Hash{upgradedTopic}
+	add := func(events map[common.Hash]string) {
+		for h := range events {
+			if !seen[h] {
+				seen[h] = true
+				topics = append(topics, h)
+			}
+		}
+	}
+	add(c.events)
+	for _, v := range c.history {
+		add(v.events)
+	}
+	return topics
+}
+
+// loadUpgrades builds the ABI timeline of a proxy from the start block on. The current ABI
+// is kept for blocks from the latest upgrade on; the ABI of every earlier implementation is
+// resolved and used for the blocks it was active. Contracts the resolvers did not detect as
+// proxies, local ABI sources and live-only runs (no start block) are left as they are.
+func (c *Contract) loadUpgrades(ctx context.Context, client *ethclient.Client, opts *cli.Config) {
+	if opts.ABI.File != "" || len(opts.ABI.Signatures) > 0 || opts.Query.From == 0 {
+		return
+	}
+	if c.implementation == (common.Address{}) {
+		logger.Debug("contract is not a proxy, skipping its upgrade history", "contract", c.Address.Hex())
+		return
+	}
+	timeline, err := c.scanUpgrades(ctx, client, opts, uint64(opts.Query.From))
+	if err != nil {
+		logger.Warn("failed to fetch proxy upgrades, decoding every block with the current ABI", "err", err)
+		return
+	}
+	if len(timeline.Upgrades) == 0 {
+		return
+	}
+
+	last := timeline.Upgrades[len(timeline.Upgrades)-1]
+	var history []abiVersion
+	for _, u := range timeline.Upgrades[:len(timeline.Upgrades)-1] {
+		parsed, err := implementationABI(ctx, opts, u.Implementation)
+		if err != nil {
+			// the era is kept with an empty ABI, so its logs are not decoded with the ABI of
+			// another implementation
+			logger.Error("failed to resolve ABI of past implementation, its logs will not be decoded",
+				"implementation", u.Implementation.Hex(), "from", u.Block, "err", err)
+		}
+		history = append(history, newABIVersion(u.Block, u.Implementation, parsed))
+	}
+	c.mu.Lock()
+	c.since, c.implementation = last.Block, last.Implementation
+	c.history = append(c.history, history...)
+	c.mu.Unlock()
+	logger.Info("loaded proxy upgrade history",
+		"upgrades", len(timeline.Upgrades)-1,
+		"implementation", c.implementation.Hex(),
+		"since", c.since)
+}
+
+// upgradeEntry is an implementation of a proxy, active from Block until the next entry.
+type upgradeEntry struct {
+	Block          uint64         `json:"block"`
+	Implementation common.Address `json:"implementation"`
+}
+
+// upgradeTimeline is the implementation history of a proxy from block From on, scanned for
+// Upgraded events up to ScannedTo. It is cached in <ABI cache>/upgrades/<chainID>/<address>.json
+// so restarts only scan the blocks added since.
+type upgradeTimeline struct {
+	From      uint64         `json:"from"`
+	ScannedTo uint64         `json:"scannedTo"`
+	Upgrades  []upgradeEntry `json:"upgrades"`
+}
+
+// add appends an upgrade to impl at block, unless impl is already the latest implementation.
+func (t *upgradeTimeline) add(block uint64, impl common.Address) {
+	if n := len(t.Upgrades); n > 0 && t.Upgrades[n-1].Implementation == impl {
+		return
+	}
+	t.Upgrades = append(t.Upgrades, upgradeEntry{Block: block, Implementation: impl})
+}
+
+// scanUpgrades returns the upgrade timeline of the contract from block from to the chain
+// head. The implementation active at from is read from the proxy's storage, which needs an
+// archive node for old blocks; without it, blocks before the first upgrade found are
+// decoded with the ABI it installed. A cached timeline is extended with the new blocks only.
+func (c *Contract) scanUpgrades(ctx context.Context, client *ethclient.Client, opts *cli.Config, from uint64) (*upgradeTimeline, error) {
+	path := upgradeCachePath(opts, c.Address)
+	timeline, err := readUpgradeTimeline(path)
+	if err != nil || timeline.From > from {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("ignoring cached upgrade timeline", "file", path, "err", err)
+		}
+		timeline = &upgradeTimeline{From: from, ScannedTo: from - 1}
+		info, err := DetectProxy(ctx, client, c.Address, new(big.Int).SetUint64(from))
+		switch {
+		case err != nil:
+			logger.Warn("failed to read the proxy implementation at the start block", "block", from, "err", err)
+		case info != nil:
+			timeline.add(from, info.Implementation)
+		}
+	}
+
+	head, err := client.BlockNumber(ctx)
+	metrics.ObserveRPC("eth_blockNumber", err)
+	if err != nil {
+		return nil, err
+	}
+	if timeline.ScannedTo < head {
+		err = filterWindows(ctx, client, opts, [][]common.Hash{{upgradedTopic}}, timeline.ScannedTo+1, head, func(_, end uint64, window []types.Log) error {
+			for _, l := range window {
+				if impl := upgradeTarget(l); impl != (common.Address{}) {
+					timeline.add(l.BlockNumber, impl)
+				}
+			}
+			timeline.ScannedTo = end
+			return nil
+		})
+	}
+	// the blocks scanned so far are kept even when a window failed
+	if path != "" {
+		if err := writeUpgradeTimeline(path, timeline); err != nil {
+			logger.Warn("failed to cache upgrade timeline", "file", path, "err", err)
+		}
+	}
+	return timeline, err
+}
+
+// upgradeCachePath returns the cache file of the upgrade timeline of address, empty when the
+// ABI cache is disabled.
+func upgradeCachePath(opts *cli.Config, address common.Address) string {
+	if opts.ABI.CacheDir == "" {
+		return ""
+	}
+	return filepath.Join(opts.ABI.CacheDir, "upgrades", strconv.FormatInt(opts.API.ChainID, 10), strings.ToLower(address.Hex())+".json")
+}
+
+func readUpgradeTimeline(path string) (*upgradeTimeline, error) {
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var timeline upgradeTimeline
+	if err := json.Unmarshal(data, &timeline); err != nil {
+		return nil, fmt.Errorf("corrupt upgrade timeline %s: %w", path, err)
+	}
+	return &timeline, nil
+}
+
+func writeUpgradeTimeline(path string, timeline *upgradeTimeline) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(timeline, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a truncated file behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// upgrade switches the current ABI when l is an Upgraded event of the contract to an
+// implementation not seen yet. The previous ABI is kept for older blocks.
+func (c *Contract) upgrade(opts *cli.Config, l types.Log) {
+	if len(l.Topics) == 0 || l.Topics[0] != upgradedTopic || l.Address != c.Address {
+		return
+	}
+	impl := upgradeTarget(l)
+	if impl == (common.Address{}) || impl == c.implementation || l.BlockNumber < c.since {
+		return
+	}
+
+	parsed, err := implementationABI(context.Background(), opts, impl)
+	if err != nil {
+		logger.Error("failed to resolve ABI of new implementation, keeping the current one", "implementation", impl.Hex(), "err", err)
+		return
+	}
+	c.mu.Lock()
+	c.history = append(c.history, newABIVersion(c.since, c.implementation, c.ABI))
+	current := newABIVersion(l.BlockNumber, impl, parsed)
+	c.ABI, c.events = current.abi, current.events
+	c.since, c.implementation = l.BlockNumber, impl
+	c.mu.Unlock()
+	logger.Info("proxy upgraded, switched contract ABI", "implementation", impl.Hex(), "block", l.BlockNumber, "events", len(c.events))
+}
+
+// implementationABI resolves the ABI of a proxy implementation, merged with the proxy's own ABI.
+func implementationABI(ctx context.Context, opts *cli.Config, impl common.Address) (abi.ABI, error) {
+	res, err := resolveAddressABI(ctx, opts, impl, false)
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	proxy := resolveProxyABI(ctx, opts, common.HexToAddress(opts.Query.Address), false)
+	return decoderABI(opts, res.ABI, &proxy)
+}
+
+// upgradeTarget returns the implementation address of an Upgraded log. EIP-1967 proxies
+// index it, ZeppelinOS and early OpenZeppelin proxies (e.g. USDC) put it in the data. The
+// zero address is returned for malformed logs.
+func upgradeTarget(l types.Log) common.Address {
+	switch {
+	case len(l.Topics) >= 2:
+		return common.BytesToAddress(l.Topics[1].Bytes())
+	case len(l.Data) == common.HashLength:
+		return common.BytesToAddress(l.Data)
+	default:
+		return common.Address{}
+	}
+}
@@ -2,7 +2,7 @@ package subsrciber
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum"
@@ -10,10 +10,21 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/logging"
+	"github.com/naman1402/geth-indexer/metrics"
+	"github.com/naman1402/geth-indexer/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // major functions: filter and listen
 
+var (
+	logger = logging.For("subscriber")
+	tracer = tracing.Tracer("subscriber")
+)
+
 var (
 	from *big.Int
 	to   *big.Int
@@ -21,7 +32,7 @@ var (
 
 // ethClient.Client defines typed wrappers for the Ethereum RPC API.
 // Log represents a contract log event
-func filter(client *ethclient.Client, opts *cli.Config, topics [][]common.Hash) []types.Log {
+func filter(ctx context.Context, client *ethclient.Client, opts *cli.Config, topics [][]common.Hash) ([]types.Log, error) {
 
 	// if from/to field in query is not zero, assign it to from/to variables
 	// or else set them as nil (latest block)
@@ -36,6 +47,26 @@ func filter(client *ethclient.Client, opts *cli.Config, topics [][]common.Hash)
 		to = nil
 	}
 
+	logs, err := filterRange(ctx, client, opts, from, to, topics)
+	if err != nil {
+		return nil, err
+	}
+	// fmt.Print("Logs filtered successfully\n")
+	// fmt.Println("called the eth client with FilterLogs function, here is the output:")
+	// for _, log := range logs {
+	// 	fmt.Printf("Log: %+v\n", log)
+	// }
+
+	return logs, nil
+}
+
+// filterRange fetches the logs of the configured contract between from and to (nil means latest).
+// Every call is one filter window and gets its own span.
+func filterRange(ctx context.Context, client *ethclient.Client, opts *cli.Config, from, to *big.Int, topics [][]common.Hash) ([]types.Log, error) {
+	ctx, span := tracer.Start(ctx, "subscriber.filter",
+		trace.WithAttributes(attribute.String("from", blockLabel(from)), attribute.String("to", blockLabel(to))))
+	defer span.End()
+
 	// FilterQuery contains options for contract log filtering.
 	// Defines the filter criteria for retrieving logs from the Ethereum blockchain.
 	query := ethereum.FilterQuery{
@@ -50,37 +81,109 @@ func filter(client *ethclient.Client, opts *cli.Config, topics [][]common.Hash)
 
 	// FilterLogs executes a filter query.
 	// executes filter query on client with current context, retrieves logs that match the query and assign them to logs
-	logs, err := client.FilterLogs(context.Background(), query)
+	logs, err := client.FilterLogs(ctx, query)
+	metrics.ObserveRPC("eth_getLogs", err)
 	if err != nil {
-		log.Fatal(err)
+		recordSpanError(span, err)
+		return nil, err
 	}
-	// fmt.Print("Logs filtered successfully\n")
-	// fmt.Println("called the eth client with FilterLogs function, here is the output:")
-	// for _, log := range logs {
-	// 	fmt.Printf("Log: %+v\n", log)
-	// }
+	span.SetAttributes(attribute.Int("logs", len(logs)))
+	return logs, nil
+}
+
+// backfill re-fetches the logs in [from, to] in windows of opts.Query.Window blocks and sends
+// them to logCh. A to of 0 backfills up to the current chain head.
+func backfill(ctx context.Context, client *ethclient.Client, opts *cli.Config, topics [][]common.Hash, from, to uint64, logCh chan<- types.Log) error {
+	ctx, span := tracer.Start(ctx, "subscriber.backfill")
+	defer span.End()
+
+	err := filterWindows(ctx, client, opts, topics, from, to, func(start, end uint64, logs []types.Log) error {
+		logger.Info("backfilled blocks", "from", start, "to", end, "logs", len(logs))
+		metrics.LogsReceived.WithLabelValues("backfill").Add(float64(len(logs)))
+		for _, l := range logs {
+			select {
+			case logCh <- l:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		recordSpanError(span, err)
+	}
+	return err
+}
+
+// filterWindows fetches the logs in [from, to] in windows of opts.Query.Window blocks, so
+// providers capping the eth_getLogs range accept every call, and passes each window to fn.
+// A to of 0 means the current chain head.
+func filterWindows(ctx context.Context, client *ethclient.Client, opts *cli.Config, topics [][]common.Hash, from, to uint64, fn func(start, end uint64, logs []types.Log) error) error {
+	if to == 0 {
+		head, err := client.BlockNumber(ctx)
+		metrics.ObserveRPC("eth_blockNumber", err)
+		if err != nil {
+			return err
+		}
+		to = head
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("from", int64(from)), attribute.Int64("to", int64(to)))
+	window := uint64(opts.Query.Window)
+	if window == 0 {
+		window = 2000
+	}
+
+	for start := from; start <= to; start += window {
+		end := start + window - 1
+		if end > to {
+			end = to
+		}
+		logs, err := filterRange(ctx, client, opts, new(big.Int).SetUint64(start), new(big.Int).SetUint64(end), topics)
+		if err != nil {
+			return fmt.Errorf("failed to filter blocks %d-%d: %w", start, end, err)
+		}
+		if err := fn(start, end, logs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockLabel formats a filter bound, nil meaning the latest block.
+func blockLabel(b *big.Int) string {
+	if b == nil {
+		return "latest"
+	}
+	return b.String()
+}
 
-	return logs
+// recordSpanError marks span as failed with err.
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
 }
 
 // ethereum.Subscription represents an event subscription where events are delivered on a data channel.
-func listen(client *ethclient.Client, opts *cli.Config) (ethereum.Subscription, <-chan types.Log) {
+// topics narrow the subscription like in filter, nil receives every log of the contract.
+func listen(ctx context.Context, client *ethclient.Client, opts *cli.Config, topics [][]common.Hash) (ethereum.Subscription, <-chan types.Log, error) {
 	// make a channel of type types.Log
 	logs := make(chan types.Log)
 	// Creates a query that sets Addresses field to a slice containing the address specified in opts, converts to common.Address
 	query := ethereum.FilterQuery{
 		Addresses: []common.Address{common.HexToAddress(opts.Query.Address)},
+		Topics:    topics,
 	}
 
 	// SubscribeFilterLogs subscribes to the results of a streaming filter query.
 	// This sets up a subscription to continuously receive logs from the Ethereum blockchain based on the specified query.
-	// If there's an issue with the query or the connection to the blockchain, it logs the error and stops execution.
-	sub, err := client.SubscribeFilterLogs(context.Background(), query, logs)
+	// If there's an issue with the query or the connection to the blockchain, the error is returned.
+	sub, err := client.SubscribeFilterLogs(ctx, query, logs)
+	metrics.ObserveRPC("eth_subscribe", err)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 	// returns ethereum.Subscription
-	return sub, logs
+	return sub, logs, nil
 }
 
 // func GetImplementationContractAddress(client *ethclient.Client, proxyAddress common.Address) (common.Address, error) {
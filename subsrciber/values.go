@@ -0,0 +1,145 @@
+package subsrciber
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Decoded event values (Event.Data) use one model, whatever the ABI type:
+//   - int<N>, uint<N>: *big.Int
+//   - address: checksummed hex string
+//   - bool: bool
+//   - string: string
+//   - bytes, bytes<N>, function: 0x-prefixed hex string
+//   - T[] and T[N]: []interface{} of the element values
+//   - tuples: map[string]interface{} keyed by component name (the position when unnamed)
+//   - indexed string, bytes, arrays and tuples: 0x-prefixed hex of the keccak256 hash in
+//     the topic, the value itself is not recoverable
+//
+// Sinks only have to handle these types; JSONValue converts them for JSON and text sinks.
+
+// normalizeValue converts a value unpacked by go-ethereum for type t to the decoded-value model.
+func normalizeValue(t abi.Type, v interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && t.T != abi.IntTy && t.T != abi.UintTy {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		return toBigInt(v)
+	case abi.AddressTy:
+		addr, ok := v.(common.Address)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %T for address", v)
+		}
+		return addr.Hex(), nil
+	case abi.BoolTy, abi.StringTy:
+		return rv.Interface(), nil
+	case abi.BytesTy:
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %T for bytes", v)
+		}
+		return hexutil.Encode(b), nil
+	case abi.FixedBytesTy, abi.FunctionTy, abi.HashTy:
+		if rv.Kind() != reflect.Array {
+			return nil, fmt.Errorf("unexpected %T for %s", v, t)
+		}
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return hexutil.Encode(b), nil
+	case abi.SliceTy, abi.ArrayTy:
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			elem, err := normalizeValue(*t.Elem, rv.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = elem
+		}
+		return out, nil
+	case abi.TupleTy:
+		if rv.Kind() != reflect.Struct || rv.NumField() != len(t.TupleElems) {
+			return nil, fmt.Errorf("unexpected %T for %s", v, t)
+		}
+		out := make(map[string]interface{}, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			name := t.TupleRawNames[i]
+			if name == "" {
+				name = fmt.Sprint(i)
+			}
+			value, err := normalizeValue(*elem, rv.Field(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			out[name] = value
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported ABI type %s", t)
+	}
+}
+
+// JSONValue converts a decoded value to JSON-compatible values, integers, nested ones
+// included, becoming decimal strings so no precision is lost in JSON clients.
+func JSONValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case *big.Int:
+		return val.String()
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, elem := range val {
+			out[i] = JSONValue(elem)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, elem := range val {
+			out[k] = JSONValue(elem)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// toBigInt converts the integer types go-ethereum unpacks to (int8..int64, uint8..uint64
+// and *big.Int) to *big.Int.
+func toBigInt(v interface{}) (*big.Int, error) {
+	if b, ok := v.(*big.Int); ok {
+		return b, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(rv.Uint()), nil
+	}
+	return nil, fmt.Errorf("unexpected %T for integer", v)
+}
+
+// decodeTopic decodes the value of an indexed argument from its topic. Dynamic types and
+// tuples are stored hashed, so their hash is returned.
+func decodeTopic(arg abi.Argument, topic common.Hash) (interface{}, error) {
+	switch arg.Type.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return topic.Hex(), nil
+	}
+	// a topic holds a static value ABI-encoded in one word
+	word := abi.Arguments{{Name: arg.Name, Type: arg.Type}}
+	values, err := word.Unpack(topic.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return normalizeValue(arg.Type, values[0])
+}
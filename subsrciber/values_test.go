@@ -0,0 +1,170 @@
+package subsrciber
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func newType(t *testing.T, typ string, components ...abi.ArgumentMarshaling) abi.Type {
+	t.Helper()
+	parsed, err := abi.NewType(typ, "", components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func bigInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		panic("invalid integer " + s)
+	}
+	return v
+}
+
+func TestNormalizeValue(t *testing.T) {
+	holder := common.HexToAddress("0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc")
+	transfer := []abi.ArgumentMarshaling{{Name: "to", Type: "address"}, {Name: "amount", Type: "uint256"}}
+	maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	for _, tc := range []struct {
+		name  string
+		typ   abi.Type
+		value interface{}
+		// want is the JSONValue of the normalized value
+		want interface{}
+	}{
+		{"uint8", newType(t, "uint8"), uint8(255), "255"},
+		{"int64", newType(t, "int64"), int64(-42), "-42"},
+		{"uint256 max", newType(t, "uint256"), maxUint256, maxUint256.String()},
+		{"int256 negative", newType(t, "int256"), bigInt("-1000000000000000000000000"), "-1000000000000000000000000"},
+		{"address", newType(t, "address"), holder, "0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc"},
+		{"bool", newType(t, "bool"), true, true},
+		{"string", newType(t, "string"), "WETH", "WETH"},
+		{"bytes", newType(t, "bytes"), []byte{0xde, 0xad, 0xbe, 0xef}, "0xdeadbeef"},
+		{"empty bytes", newType(t, "bytes"), []byte{}, "0x"},
+		{"bytes4", newType(t, "bytes4"), [4]byte{0xa9, 0x05, 0x9c, 0xbb}, "0xa9059cbb"},
+		{"bytes32", newType(t, "bytes32"), [32]byte{31: 1},
+			"0x0000000000000000000000000000000000000000000000000000000000000001"},
+		{"uint256[]", newType(t, "uint256[]"), []*big.Int{big.NewInt(1), maxUint256},
+			[]interface{}{"1", maxUint256.String()}},
+		{"int8[2]", newType(t, "int8[2]"), [2]int8{-1, 1}, []interface{}{"-1", "1"}},
+		{"bytes2[]", newType(t, "bytes2[]"), [][2]byte{{0xab, 0xcd}}, []interface{}{"0xabcd"}},
+		{"address[][]", newType(t, "address[][]"), [][]common.Address{{holder}, {}},
+			[]interface{}{[]interface{}{holder.Hex()}, []interface{}{}}},
+		{"tuple", newType(t, "tuple", transfer...),
+			struct {
+				To     common.Address
+				Amount *big.Int
+			}{holder, big.NewInt(7)},
+			map[string]interface{}{"to": holder.Hex(), "amount": "7"}},
+		{"tuple[] with a nested tuple", newType(t, "tuple[]",
+			abi.ArgumentMarshaling{Name: "id", Type: "bytes32"},
+			abi.ArgumentMarshaling{Name: "transfer", Type: "tuple", Components: transfer}),
+			[]struct {
+				Id       [32]byte
+				Transfer struct {
+					To     common.Address
+					Amount *big.Int
+				}
+			}{{Id: [32]byte{0: 0xff}, Transfer: struct {
+				To     common.Address
+				Amount *big.Int
+			}{holder, big.NewInt(0)}}},
+			[]interface{}{map[string]interface{}{
+				"id":       "0xff00000000000000000000000000000000000000000000000000000000000000",
+				"transfer": map[string]interface{}{"to": holder.Hex(), "amount": "0"},
+			}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// go through an ABI round trip so the value has the type go-ethereum unpacks to
+			args := abi.Arguments{{Type: tc.typ}}
+			packed, err := args.Pack(tc.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unpacked, err := args.Unpack(packed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := normalizeValue(tc.typ, unpacked[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if json := JSONValue(got); !reflect.DeepEqual(json, tc.want) {
+				t.Errorf("got %#v, want %#v", json, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeValueIntegers(t *testing.T) {
+	// integers are *big.Int at every size, so sinks never see int8..uint64
+	for _, typ := range []string{"uint8", "int16", "uint32", "int64", "uint128", "int256"} {
+		args := abi.Arguments{{Type: newType(t, typ)}}
+		unpacked, err := args.Unpack(common.LeftPadBytes([]byte{100}, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := normalizeValue(args[0].Type, unpacked[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := got.(*big.Int); !ok || v.Int64() != 100 {
+			t.Errorf("%s: got %T %v, want *big.Int 100", typ, got, got)
+		}
+	}
+
+	if _, err := normalizeValue(newType(t, "address"), "0x00"); err == nil {
+		t.Error("a string for an address: want an error")
+	}
+	if _, err := normalizeValue(newType(t, "uint256"), "1"); err == nil {
+		t.Error("a string for an integer: want an error")
+	}
+}
+
+func TestDecodeTopic(t *testing.T) {
+	holder := common.HexToAddress("0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc")
+	hashed := crypto.Keccak256Hash([]byte("hello"))
+
+	for _, tc := range []struct {
+		name  string
+		typ   abi.Type
+		topic common.Hash
+		want  interface{}
+	}{
+		{"address", newType(t, "address"), common.BytesToHash(holder.Bytes()), holder.Hex()},
+		{"uint256", newType(t, "uint256"), common.BigToHash(big.NewInt(1e18)), "1000000000000000000"},
+		{"int8 negative", newType(t, "int8"),
+			common.HexToHash("0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"), "-2"},
+		{"bool", newType(t, "bool"), common.BigToHash(big.NewInt(1)), true},
+		{"bytes4", newType(t, "bytes4"), common.HexToHash("0xa9059cbb00000000000000000000000000000000000000000000000000000000"), "0xa9059cbb"},
+		{"bytes32", newType(t, "bytes32"), hashed, hashed.Hex()},
+		// dynamic types and tuples are hashed in the topic, the hash is all that is recoverable
+		{"string", newType(t, "string"), hashed, hashed.Hex()},
+		{"bytes", newType(t, "bytes"), hashed, hashed.Hex()},
+		{"uint256[]", newType(t, "uint256[]"), hashed, hashed.Hex()},
+		{"address[2]", newType(t, "address[2]"), hashed, hashed.Hex()},
+		{"tuple", newType(t, "tuple", abi.ArgumentMarshaling{Name: "a", Type: "uint256"}), hashed, hashed.Hex()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeTopic(abi.Argument{Name: "x", Type: tc.typ, Indexed: true}, tc.topic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if json := JSONValue(got); !reflect.DeepEqual(json, tc.want) {
+				t.Errorf("got %#v, want %#v", json, tc.want)
+			}
+		})
+	}
+
+	// a bool topic holding anything but 0 or 1 is not a valid encoding
+	if v, err := decodeTopic(abi.Argument{Type: newType(t, "bool"), Indexed: true}, common.BigToHash(big.NewInt(2))); err == nil {
+		t.Errorf("bool topic 2: got %v, want an error", v)
+	}
+}
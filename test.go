@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"sync"
 
 	"github.com/naman1402/geth-indexer/cli"
 	"github.com/naman1402/geth-indexer/indexer"
+	"github.com/naman1402/geth-indexer/logging"
 	"github.com/naman1402/geth-indexer/subsrciber"
 )
 
@@ -17,9 +20,8 @@ func exec_test() int {
 	wg.Add(1)
 
 	options := cli.Run()
-	fmt.Printf("Loaded configuration\nRPC Node URL (WS): %+v\nEtherscan API Key: %+v\n", options.API.EthNodeURL, options.API.EtherscanAPI)
-	fmt.Printf("Database configuration: Host=%s, Port=%d, User=%s, DBName=%s\n", options.Database.DBHost, options.Database.DBPort, options.Database.DBUser, options.Database.DBName)
-	fmt.Printf("Query configuration: Address=%s, From=%d, To=%d\n", options.Query.Address, options.Query.From, options.Query.To)
+	logging.Setup(options.Log)
+	slog.Info("loaded configuration", "config", options)
 
 	flag.Parse()
 	events := flag.Args()
@@ -86,7 +88,12 @@ func exec_test() int {
 
 	// _ = subsrciber.FetchABI(options)
 	// fmt.Println(abi)
-	go subsrciber.Subscribe(events, eventChannel, options, quitChannel)
+	contract, err := subsrciber.NewContract(options)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	go subsrciber.Subscribe(context.Background(), events, eventChannel, options, contract, subsrciber.NewController())
 	// go indexer.Index(eventChannel, db, quitChannel)
 
 	wg.Wait()
@@ -0,0 +1,62 @@
+// Package tracing configures OpenTelemetry tracing for the indexer pipeline.
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/naman1402/geth-indexer/cli"
+	"github.com/naman1402/geth-indexer/logging"
+)
+
+const serviceName = "geth-indexer"
+
+// Tracer returns the tracer used by a pipeline component, e.g. "subscriber".
+func Tracer(component string) trace.Tracer {
+	return otel.Tracer("github.com/naman1402/geth-indexer/" + component)
+}
+
+// Setup installs a global tracer provider exporting spans over OTLP/gRPC to opts.Endpoint.
+// Tracing stays a no-op when no endpoint is configured. The returned function flushes
+// pending spans and must be called before exiting.
+func Setup(ctx context.Context, opts cli.TracingConfig) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporterOpts []otlptracegrpc.Option
+	if strings.Contains(opts.Endpoint, "://") {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithEndpointURL(opts.Endpoint))
+	} else {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+	}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	logging.For("tracing").Info("exporting spans", "endpoint", opts.Endpoint)
+	return provider.Shutdown, nil
+}